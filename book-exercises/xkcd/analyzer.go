@@ -0,0 +1,275 @@
+// analyzer.go
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// AnalyzerConfig descreve a cadeia de análise usada para gerar os termos.
+// Fica gravada no índice: a busca usa exatamente a mesma configuração, e uma
+// indexação incremental com configuração diferente força rebuild.
+type AnalyzerConfig struct {
+	Fold      bool     `json:"fold"`                 // remover acentos (é -> e, ç -> c)
+	MinLen    int      `json:"min_len"`              // tamanho mínimo do token (em runes)
+	StopWords []string `json:"stop_words,omitempty"` // já normalizadas e ordenadas
+	Stemmer   string   `json:"stemmer"`              // nome em stemmers
+}
+
+func defaultAnalyzerConfig() AnalyzerConfig {
+	return AnalyzerConfig{
+		Fold:      true,
+		MinLen:    2,
+		StopWords: normalizeWordList(stopWordLists["en"], true),
+		Stemmer:   "english",
+	}
+}
+
+func (c AnalyzerConfig) equal(o AnalyzerConfig) bool {
+	return c.Fold == o.Fold && c.MinLen == o.MinLen && c.Stemmer == o.Stemmer &&
+		slices.Equal(c.StopWords, o.StopWords)
+}
+
+func (c AnalyzerConfig) String() string {
+	return fmt.Sprintf("stemmer=%s fold=%t stopwords=%d min_len=%d", c.Stemmer, c.Fold, len(c.StopWords), c.MinLen)
+}
+
+// stemmers disponíveis; nil = sem stemming
+var stemmers = map[string]func(string) string{
+	"none":       nil,
+	"english":    porterStem,
+	"portuguese": portugueseStem,
+}
+
+// Token: termo analisado, com a posição da palavra no texto (contando as
+// palavras descartadas, para frases e NEAR respeitarem as lacunas) e o trecho
+// [Start, End) em bytes do texto original
+type Token struct {
+	Term       string
+	Pos        int
+	Start, End int
+}
+
+// tokenFilter transforma um termo; "" descarta o token
+type tokenFilter func(string) string
+
+// Analyzer: segmentação Unicode seguida de uma sequência de filtros
+// (minúsculas, remoção de acentos, tamanho mínimo, stop words, stemming)
+type Analyzer struct {
+	cfg     AnalyzerConfig
+	filters []tokenFilter
+}
+
+func newAnalyzer(cfg AnalyzerConfig) (*Analyzer, error) {
+	stem, ok := stemmers[cfg.Stemmer]
+	if !ok {
+		return nil, fmt.Errorf("stemmer desconhecido %q (disponíveis: %s)", cfg.Stemmer, strings.Join(sortedKeys(stemmers), ", "))
+	}
+	a := &Analyzer{cfg: cfg}
+	a.filters = append(a.filters, a.normalize)
+	if cfg.MinLen > 1 {
+		a.filters = append(a.filters, func(t string) string {
+			if utf8.RuneCountInString(t) < cfg.MinLen {
+				return ""
+			}
+			return t
+		})
+	}
+	if len(cfg.StopWords) > 0 {
+		stop := make(map[string]bool, len(cfg.StopWords))
+		for _, w := range cfg.StopWords {
+			stop[w] = true
+		}
+		a.filters = append(a.filters, func(t string) string {
+			if stop[t] {
+				return ""
+			}
+			return t
+		})
+	}
+	if stem != nil {
+		a.filters = append(a.filters, stem)
+	}
+	return a, nil
+}
+
+// normalize: minúsculas e, se configurado, sem acentos (sem stemming nem stop words)
+func (a *Analyzer) normalize(w string) string {
+	w = strings.ToLower(w)
+	if a.cfg.Fold {
+		w = foldDiacritics(w)
+	}
+	return w
+}
+
+// Analyze segmenta o texto em palavras (sequências de letras, dígitos e marcas
+// combinantes) e aplica os filtros a cada uma
+func (a *Analyzer) Analyze(text string) []Token {
+	var out []Token
+	pos := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if !isWordRune(r) {
+			i += size
+			continue
+		}
+		start := i
+		for i < len(text) {
+			r, size := utf8.DecodeRuneInString(text[i:])
+			if !isWordRune(r) {
+				break
+			}
+			i += size
+		}
+		if term := a.term(text[start:i]); term != "" {
+			out = append(out, Token{Term: term, Pos: pos, Start: start, End: i})
+		}
+		pos++
+	}
+	return out
+}
+
+// term aplica os filtros a uma palavra já separada (como as de DocInfo.Words);
+// "" se ela não gera termo
+func (a *Analyzer) term(w string) string {
+	for _, f := range a.filters {
+		if w = f(w); w == "" {
+			break
+		}
+	}
+	return w
+}
+
+// Terms devolve só os termos de Analyze
+func (a *Analyzer) Terms(text string) []string {
+	toks := a.Analyze(text)
+	out := make([]string, len(toks))
+	for i, t := range toks {
+		out[i] = t.Term
+	}
+	return out
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// foldTable: letras latinas acentuadas -> forma sem acento
+var foldTable = func() map[rune]string {
+	groups := map[string]string{
+		"a":  "àáâãäåāăąǎ",
+		"c":  "çćĉċč",
+		"d":  "ďđð",
+		"e":  "èéêëēĕėęě",
+		"g":  "ĝğġģ",
+		"h":  "ĥħ",
+		"i":  "ìíîïĩīĭįı",
+		"j":  "ĵ",
+		"k":  "ķ",
+		"l":  "ĺļľŀł",
+		"n":  "ñńņňŉ",
+		"o":  "òóôõöøōŏőǒ",
+		"r":  "ŕŗř",
+		"s":  "śŝşšș",
+		"t":  "ţťŧț",
+		"u":  "ùúûüũūŭůűųǔ",
+		"w":  "ŵ",
+		"y":  "ýÿŷ",
+		"z":  "źżž",
+		"ae": "æ",
+		"oe": "œ",
+		"ss": "ß",
+		"th": "þ",
+	}
+	m := map[rune]string{}
+	for base, rs := range groups {
+		for _, r := range rs {
+			m[r] = base
+		}
+	}
+	return m
+}()
+
+// foldDiacritics remove acentos de texto em minúsculas (e marcas combinantes soltas)
+func foldDiacritics(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			b.WriteRune(r)
+			continue
+		}
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if f, ok := foldTable[r]; ok {
+			b.WriteString(f)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// normalizeWordList: minúsculas, sem acentos (se fold), sem duplicatas, ordenada
+func normalizeWordList(words []string, fold bool) []string {
+	set := map[string]bool{}
+	for _, w := range words {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if fold {
+			w = foldDiacritics(w)
+		}
+		if w != "" {
+			set[w] = true
+		}
+	}
+	out := make([]string, 0, len(set))
+	for w := range set {
+		out = append(out, w)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// parseStopWords interpreta --stopwords: nomes de listas embutidas (en, pt)
+// ou caminhos de arquivo (uma palavra por linha, # comenta), separados por
+// vírgula; "none" desliga as stop words
+func parseStopWords(spec string, fold bool) ([]string, error) {
+	var words []string
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "" || part == "none":
+		case stopWordLists[part] != nil:
+			words = append(words, stopWordLists[part]...)
+		default:
+			ws, err := readWordFile(part)
+			if err != nil {
+				return nil, fmt.Errorf("lista de stop words %q: %w", part, err)
+			}
+			words = append(words, ws...)
+		}
+	}
+	return normalizeWordList(words, fold), nil
+}
+
+func readWordFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		out = append(out, strings.Fields(line)...)
+	}
+	return out, sc.Err()
+}
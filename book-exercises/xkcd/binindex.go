@@ -0,0 +1,356 @@
+// binindex.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"slices"
+	"sort"
+)
+
+// Formato binário do índice (index.bin):
+//
+//	cabeçalho: magic "XKCDIDX\x00" | versão do formato (uint16) |
+//	           crc32 do payload (uint32) | tamanho do payload (uint64)
+//	payload:   versão do índice | analisador (JSON) | tabela de campos |
+//	           dicionário de palavras | documentos (número, data AAAAMMDD,
+//	           tamanhos, ids das palavras) | dicionário de termos
+//
+// Inteiros do payload são uvarint. Números de quadrinhos, posições e ids de
+// palavras são gravados como deltas em relação ao anterior; os dicionários são
+// ordenados e cada entrada guarda só o sufixo que difere da anterior.
+const (
+	binMagic         = "XKCDIDX\x00"
+	binFormatVersion = 3
+	binHeaderSize    = len(binMagic) + 2 + 4 + 8
+)
+
+var errBadChecksum = errors.New("checksum do índice binário não confere (arquivo corrompido?)")
+
+// isBinaryIndex diz se os bytes começam com o magic do formato binário
+func isBinaryIndex(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(binMagic))
+}
+
+func encodeIndexBinary(idx *Index) []byte {
+	var p bytes.Buffer
+	putUvarint(&p, uint64(idx.Version))
+	cfg, _ := json.Marshal(idx.Analyzer)
+	putString(&p, string(cfg))
+
+	// tabela de campos: nome -> id (posição na tabela)
+	fieldSet := map[string]bool{}
+	for _, d := range idx.Docs {
+		for f := range d.Lens {
+			fieldSet[f] = true
+		}
+	}
+	for _, ps := range idx.Terms {
+		for _, pt := range ps {
+			for f := range pt.Positions {
+				fieldSet[f] = true
+			}
+		}
+	}
+	fields := make([]string, 0, len(fieldSet))
+	for f := range fieldSet {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	fieldID := make(map[string]uint64, len(fields))
+	putUvarint(&p, uint64(len(fields)))
+	for i, f := range fields {
+		fieldID[f] = uint64(i)
+		putString(&p, f)
+	}
+
+	// dicionário de palavras (DocInfo.Words): palavra -> id
+	wordSet := map[string]bool{}
+	for _, d := range idx.Docs {
+		for _, w := range d.Words {
+			wordSet[w] = true
+		}
+	}
+	words := sortedKeys(wordSet)
+	wordID := make(map[string]uint64, len(words))
+	putUvarint(&p, uint64(len(words)))
+	prevWord := ""
+	for i, w := range words {
+		wordID[w] = uint64(i)
+		shared := commonPrefixLen(prevWord, w)
+		putUvarint(&p, uint64(shared))
+		putString(&p, w[shared:])
+		prevWord = w
+	}
+
+	// documentos
+	nums := idx.allNums()
+	putUvarint(&p, uint64(len(nums)))
+	prev := 0
+	for _, n := range nums {
+		putUvarint(&p, uint64(n-prev))
+		prev = n
+		putUvarint(&p, dateKey(idx.Docs[n].Date))
+		lens := idx.Docs[n].Lens
+		putUvarint(&p, uint64(len(lens)))
+		for _, f := range sortedKeys(lens) {
+			putUvarint(&p, fieldID[f])
+			putUvarint(&p, uint64(lens[f]))
+		}
+		// Words está em ordem, então os ids também
+		ws := idx.Docs[n].Words
+		putUvarint(&p, uint64(len(ws)))
+		last := uint64(0)
+		for _, w := range ws {
+			putUvarint(&p, wordID[w]-last)
+			last = wordID[w]
+		}
+	}
+
+	// dicionário de termos + postings
+	terms := make([]string, 0, len(idx.Terms))
+	for t := range idx.Terms {
+		terms = append(terms, t)
+	}
+	sort.Strings(terms)
+	putUvarint(&p, uint64(len(terms)))
+	prevTerm := ""
+	for _, t := range terms {
+		shared := commonPrefixLen(prevTerm, t)
+		putUvarint(&p, uint64(shared))
+		putString(&p, t[shared:])
+		prevTerm = t
+
+		ps := idx.Terms[t]
+		putUvarint(&p, uint64(len(ps)))
+		prev := 0
+		for _, pt := range ps {
+			putUvarint(&p, uint64(pt.Num-prev))
+			prev = pt.Num
+			putUvarint(&p, uint64(len(pt.Positions)))
+			for _, f := range sortedKeys(pt.Positions) {
+				putUvarint(&p, fieldID[f])
+				pos := pt.Positions[f]
+				putUvarint(&p, uint64(len(pos)))
+				last := 0
+				for _, v := range pos {
+					putUvarint(&p, uint64(v-last))
+					last = v
+				}
+			}
+		}
+	}
+
+	payload := p.Bytes()
+	out := make([]byte, 0, binHeaderSize+len(payload))
+	out = append(out, binMagic...)
+	out = binary.LittleEndian.AppendUint16(out, binFormatVersion)
+	out = binary.LittleEndian.AppendUint32(out, crc32.ChecksumIEEE(payload))
+	out = binary.LittleEndian.AppendUint64(out, uint64(len(payload)))
+	return append(out, payload...)
+}
+
+func decodeIndexBinary(b []byte) (*Index, error) {
+	if len(b) < binHeaderSize || !isBinaryIndex(b) {
+		return nil, errors.New("não é um índice binário")
+	}
+	h := b[len(binMagic):]
+	if v := binary.LittleEndian.Uint16(h); v != binFormatVersion {
+		return nil, fmt.Errorf("versão do formato binário %d não suportada", v)
+	}
+	sum := binary.LittleEndian.Uint32(h[2:])
+	size := binary.LittleEndian.Uint64(h[6:])
+	payload := b[binHeaderSize:]
+	if uint64(len(payload)) != size {
+		return nil, fmt.Errorf("índice binário truncado (%d de %d bytes)", len(payload), size)
+	}
+	if crc32.ChecksumIEEE(payload) != sum {
+		return nil, errBadChecksum
+	}
+
+	r := &binReader{r: bufio.NewReader(bytes.NewReader(payload)), limit: len(payload)}
+	idx := &Index{Docs: map[int]*DocInfo{}, Terms: map[string][]Posting{}}
+	idx.Version = int(r.uvarint())
+	if cfg := r.string(); r.err == nil {
+		if err := json.Unmarshal([]byte(cfg), &idx.Analyzer); err != nil {
+			return nil, fmt.Errorf("índice binário inválido: analisador: %w", err)
+		}
+	}
+
+	nfields := r.uvarint()
+	if nfields > uint64(r.limit) {
+		return nil, fmt.Errorf("índice binário inválido: %d campos", nfields)
+	}
+	fields := make([]string, nfields)
+	for i := range fields {
+		fields[i] = r.string()
+	}
+	field := func() string {
+		id := r.uvarint()
+		if id >= uint64(len(fields)) {
+			r.fail(fmt.Errorf("id de campo inválido %d", id))
+			return ""
+		}
+		return fields[id]
+	}
+
+	nwords := r.uvarint()
+	if nwords > uint64(r.limit) {
+		return nil, fmt.Errorf("índice binário inválido: %d palavras", nwords)
+	}
+	words := make([]string, 0, nwords)
+	prevWord := ""
+	for i := uint64(0); i < nwords && r.err == nil; i++ {
+		shared := int(r.uvarint())
+		if shared > len(prevWord) {
+			r.fail(errors.New("prefixo de palavra inválido"))
+			break
+		}
+		prevWord = prevWord[:shared] + r.string()
+		words = append(words, prevWord)
+	}
+
+	ndocs := r.uvarint()
+	num := 0
+	for i := uint64(0); i < ndocs && r.err == nil; i++ {
+		num += int(r.uvarint())
+		d := &DocInfo{Lens: map[string]int{}, Date: fromDateKey(r.uvarint())}
+		for k := r.uvarint(); k > 0 && r.err == nil; k-- {
+			f := field()
+			d.Lens[f] = int(r.uvarint())
+		}
+		id := uint64(0)
+		for k := r.uvarint(); k > 0 && r.err == nil; k-- {
+			if id += r.uvarint(); id >= uint64(len(words)) {
+				r.fail(fmt.Errorf("id de palavra inválido %d", id))
+				break
+			}
+			d.Words = append(d.Words, words[id])
+		}
+		idx.Docs[num] = d
+	}
+
+	nterms := r.uvarint()
+	prevTerm := ""
+	for i := uint64(0); i < nterms && r.err == nil; i++ {
+		shared := int(r.uvarint())
+		if shared > len(prevTerm) {
+			r.fail(errors.New("prefixo de termo inválido"))
+			break
+		}
+		t := prevTerm[:shared] + r.string()
+		prevTerm = t
+
+		count := r.uvarint()
+		ps := make([]Posting, 0, min(count, 1<<16))
+		num := 0
+		for j := uint64(0); j < count && r.err == nil; j++ {
+			num += int(r.uvarint())
+			pt := Posting{Num: num, Positions: map[string][]int{}}
+			for k := r.uvarint(); k > 0 && r.err == nil; k-- {
+				f := field()
+				n := r.uvarint()
+				pos := make([]int, 0, min(n, 1<<16))
+				last := 0
+				for ; n > 0 && r.err == nil; n-- {
+					last += int(r.uvarint())
+					pos = append(pos, last)
+				}
+				pt.Positions[f] = pos
+			}
+			ps = append(ps, pt)
+		}
+		idx.Terms[t] = ps
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("índice binário inválido: %w", r.err)
+	}
+	return idx, nil
+}
+
+// binReader acumula o primeiro erro para o decoder não precisar checar a cada leitura
+type binReader struct {
+	r     *bufio.Reader
+	limit int // tamanho do payload, limite para strings
+	err   error
+}
+
+func (r *binReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *binReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		r.fail(err)
+		return 0
+	}
+	return v
+}
+
+func (r *binReader) string() string {
+	n := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if n > uint64(r.limit) {
+		r.fail(fmt.Errorf("string grande demais (%d bytes)", n))
+		return ""
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		r.fail(err)
+		return ""
+	}
+	return string(b)
+}
+
+func putUvarint(w *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	w.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+}
+
+func putString(w *bytes.Buffer, s string) {
+	putUvarint(w, uint64(len(s)))
+	w.WriteString(s)
+}
+
+func commonPrefixLen(a, b string) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	out := make([]K, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func saveIndexBinary(path string, idx *Index) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, encodeIndexBinary(idx), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
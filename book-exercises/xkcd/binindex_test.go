@@ -0,0 +1,203 @@
+// binindex_test.go
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var sampleWords = strings.Fields(`physics quantum cat black hole git commit branch merge
+	python compiler sandwich velociraptor stick figure graph chart science math
+	probability statistics correlation password security server database network
+	rocket orbit moon mars telescope coffee keyboard linux windows kernel bug`)
+
+// sampleIndex monta um índice com n quadrinhos de texto pseudoaleatório
+// (sempre o mesmo para a mesma semente); #404 fica de fora e #7 não tem data
+func sampleIndex(tb testing.TB, n int) *Index {
+	tb.Helper()
+	an, err := newAnalyzer(defaultAnalyzerConfig())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	text := func(k int) string {
+		ws := make([]string, k)
+		for i := range ws {
+			ws[i] = sampleWords[rng.Intn(len(sampleWords))]
+		}
+		return strings.Join(ws, " ")
+	}
+	idx := newIndex(an)
+	for num := 1; num <= n; num++ {
+		if num == 404 {
+			continue
+		}
+		c := &XKCD{Num: num, Title: text(2), SafeTitle: text(2), Alt: text(15), Transcript: text(40),
+			Year: fmt.Sprint(2006 + num/150), Month: fmt.Sprint(1 + num%12), Day: fmt.Sprint(1 + num%28)}
+		if num == 7 {
+			c.Year, c.Month, c.Day = "", "", ""
+		}
+		idx.addComic(c)
+	}
+	idx.finish()
+	return idx
+}
+
+// jsonRoundTrip passa o índice pelo formato JSON, a referência do binário
+func jsonRoundTrip(tb testing.TB, idx *Index) (*Index, []byte) {
+	tb.Helper()
+	b, err := json.Marshal(idx)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	out := &Index{}
+	if err := json.Unmarshal(b, out); err != nil {
+		tb.Fatal(err)
+	}
+	return out, b
+}
+
+func TestBinaryIndexRoundTrip(t *testing.T) {
+	idx := sampleIndex(t, 500)
+	want, jsonBytes := jsonRoundTrip(t, idx)
+	bin := encodeIndexBinary(idx)
+	if len(bin) >= len(jsonBytes) {
+		t.Errorf("binário com %d bytes, JSON compacto com %d", len(bin), len(jsonBytes))
+	}
+	got, err := decodeIndexBinary(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != want.Version || !reflect.DeepEqual(got.Analyzer, want.Analyzer) {
+		t.Fatalf("cabeçalho: versão %d analisador %+v, esperado %d %+v", got.Version, got.Analyzer, want.Version, want.Analyzer)
+	}
+	if !reflect.DeepEqual(got.Docs, want.Docs) {
+		t.Fatal("documentos diferentes do índice JSON")
+	}
+	if len(got.Terms) != len(want.Terms) {
+		t.Fatalf("%d termos, esperado %d", len(got.Terms), len(want.Terms))
+	}
+	for term, ps := range want.Terms {
+		if !reflect.DeepEqual(got.Terms[term], ps) {
+			t.Fatalf("postings de %q diferentes do índice JSON", term)
+		}
+	}
+	if got.Docs[7].Date != "" {
+		t.Errorf("data do #7 = %q, esperado vazia", got.Docs[7].Date)
+	}
+}
+
+func TestBinaryIndexSaveLoad(t *testing.T) {
+	idx := sampleIndex(t, 50)
+	dir := t.TempDir()
+	for _, name := range []string{indexFilename, indexBinFilename} {
+		path := filepath.Join(dir, name)
+		if err := saveIndex(path, idx); err != nil {
+			t.Fatal(err)
+		}
+		got, err := loadIndex(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		resp, err := got.search("quantum cat", searchOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := idx.search("quantum cat", searchOptions{})
+		if !reflect.DeepEqual(resp.Results, want.Results) {
+			t.Fatalf("%s: busca difere do índice original", name)
+		}
+	}
+}
+
+func TestBinaryIndexTruncated(t *testing.T) {
+	b := encodeIndexBinary(sampleIndex(t, 50))
+	for _, n := range []int{0, len(binMagic), binHeaderSize - 1, binHeaderSize, len(b) / 2, len(b) - 1} {
+		if _, err := decodeIndexBinary(b[:n]); err == nil {
+			t.Errorf("truncado em %d de %d bytes: sem erro", n, len(b))
+		}
+	}
+	if _, err := decodeIndexBinary(append(b[:len(b):len(b)], 0)); err == nil {
+		t.Error("byte extra no fim: sem erro")
+	}
+}
+
+func TestBinaryIndexChecksum(t *testing.T) {
+	b := encodeIndexBinary(sampleIndex(t, 50))
+	for _, off := range []int{binHeaderSize, binHeaderSize + (len(b)-binHeaderSize)/2, len(b) - 1} {
+		bad := append([]byte(nil), b...)
+		bad[off] ^= 0x40
+		if _, err := decodeIndexBinary(bad); !errors.Is(err, errBadChecksum) {
+			t.Errorf("byte %d alterado: erro %v, esperado checksum", off, err)
+		}
+	}
+
+	// checksum recalculado sobre um payload inválido: o decoder ainda recusa
+	bad := append([]byte(nil), b...)
+	for i := binHeaderSize; i < len(bad); i++ {
+		bad[i] = 0xff
+	}
+	binary.LittleEndian.PutUint32(bad[len(binMagic)+2:], crc32.ChecksumIEEE(bad[binHeaderSize:]))
+	if _, err := decodeIndexBinary(bad); err == nil {
+		t.Error("payload inválido com checksum correto: sem erro")
+	}
+
+	path := filepath.Join(t.TempDir(), indexBinFilename)
+	b[len(b)-1] ^= 1
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadIndex(path); !errors.Is(err, errBadChecksum) {
+		t.Errorf("loadIndex: erro %v, esperado checksum", err)
+	}
+}
+
+// Tamanho e velocidade do binário contra o JSON (o formato que index grava
+// por padrão); rode com go test -bench Index -benchmem.
+func BenchmarkIndexFormats(b *testing.B) {
+	idx := sampleIndex(b, 3000)
+	jsonBytes, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		b.Fatal(err)
+	}
+	binBytes := encodeIndexBinary(idx)
+
+	b.Run("encode/json", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := json.MarshalIndent(idx, "", "  "); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(len(jsonBytes)), "bytes/index")
+	})
+	b.Run("encode/bin", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			encodeIndexBinary(idx)
+		}
+		b.ReportMetric(float64(len(binBytes)), "bytes/index")
+	})
+	b.Run("decode/json", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var out Index
+			if err := json.Unmarshal(jsonBytes, &out); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("decode/bin", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := decodeIndexBinary(binBytes); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,75 @@
+// date.go
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayout: datas no índice e nos filtros são AAAA-MM-DD, que ordenam como texto
+const dateLayout = "2006-01-02"
+
+// comicDate monta a data de publicação a partir de year/month/day da API
+// (strings sem zero à esquerda); devolve "" se faltar algum ou for inválida
+func comicDate(c *XKCD) string {
+	y, err1 := strconv.Atoi(strings.TrimSpace(c.Year))
+	m, err2 := strconv.Atoi(strings.TrimSpace(c.Month))
+	d, err3 := strconv.Atoi(strings.TrimSpace(c.Day))
+	if err1 != nil || err2 != nil || err3 != nil {
+		return ""
+	}
+	t := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+	if t.Year() != y || int(t.Month()) != m || t.Day() != d {
+		return ""
+	}
+	return t.Format(dateLayout)
+}
+
+// parseDateBound aceita AAAA, AAAA-MM ou AAAA-MM-DD e devolve o primeiro dia
+// do período (ou o último, se end), para --since e --until; "" fica ""
+func parseDateBound(s string, end bool) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	for _, f := range []struct {
+		layout string
+		next   func(time.Time) time.Time
+	}{
+		{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+		{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+		{dateLayout, func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	} {
+		if len(s) != len(f.layout) {
+			continue
+		}
+		t, err := time.Parse(f.layout, s)
+		if err != nil {
+			break
+		}
+		if end {
+			t = f.next(t).AddDate(0, 0, -1)
+		}
+		return t.Format(dateLayout), nil
+	}
+	return "", fmt.Errorf("data inválida %q (use AAAA, AAAA-MM ou AAAA-MM-DD)", s)
+}
+
+// dateKey/fromDateKey convertem AAAA-MM-DD para o inteiro AAAAMMDD usado no
+// índice binário (0 = sem data)
+func dateKey(date string) uint64 {
+	t, err := time.Parse(dateLayout, date)
+	if err != nil {
+		return 0
+	}
+	return uint64(t.Year()*10000 + int(t.Month())*100 + t.Day())
+}
+
+func fromDateKey(k uint64) string {
+	if k == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", k/10000, k/100%100, k%100)
+}
@@ -0,0 +1,329 @@
+// download.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	checkpointFilename = "download.checkpoint.json"
+	failedFilename     = "failed.json"
+	// checkpointEvery: a cada quantos quadrinhos concluídos o checkpoint é gravado
+	checkpointEvery = 50
+)
+
+// downloadCheckpoint: progresso do download salvo no cache. Done é o maior n
+// tal que 1..n já estão no cache (ou não existem na origem); uma execução
+// interrompida retoma em Done+1 sem conferir os arquivos anteriores.
+type downloadCheckpoint struct {
+	Done    int       `json:"done"`
+	Updated time.Time `json:"updated"`
+}
+
+func loadCheckpoint(cacheDir string) (*downloadCheckpoint, error) {
+	cp := &downloadCheckpoint{}
+	b, err := os.ReadFile(filepath.Join(cacheDir, checkpointFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return cp, err
+	}
+	if err := json.Unmarshal(b, cp); err != nil {
+		return &downloadCheckpoint{}, err
+	}
+	return cp, nil
+}
+
+func saveCheckpoint(cacheDir string, cp *downloadCheckpoint) error {
+	cp.Updated = time.Now().UTC()
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(cacheDir, checkpointFilename)
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// downloadFailure: quadrinho que não pôde ser baixado, registrado em failed.json
+type downloadFailure struct {
+	Num    int       `json:"num"`
+	Error  string    `json:"error"`
+	Status int       `json:"status,omitempty"` // código HTTP, se houve resposta
+	Time   time.Time `json:"time"`
+}
+
+func newDownloadFailure(n int, err error) downloadFailure {
+	df := downloadFailure{Num: n, Error: err.Error(), Time: time.Now().UTC()}
+	var se *statusError
+	if errors.As(err, &se) {
+		df.Status = se.Code
+	}
+	return df
+}
+
+// failureReport: formato de failed.json
+type failureReport struct {
+	Updated  time.Time         `json:"updated"`
+	Failures []downloadFailure `json:"failures"`
+}
+
+func loadFailures(cacheDir string) (map[int]downloadFailure, error) {
+	failed := map[int]downloadFailure{}
+	b, err := os.ReadFile(filepath.Join(cacheDir, failedFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return failed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var r failureReport
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	for _, f := range r.Failures {
+		failed[f.Num] = f
+	}
+	return failed, nil
+}
+
+// saveFailures grava failed.json (em ordem de número) ou o remove se não
+// sobrou nenhuma falha
+func saveFailures(cacheDir string, failed map[int]downloadFailure) error {
+	p := filepath.Join(cacheDir, failedFilename)
+	if len(failed) == 0 {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	r := failureReport{Updated: time.Now().UTC()}
+	for _, n := range sortedKeys(failed) {
+		r.Failures = append(r.Failures, failed[n])
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// watermark acompanha o checkpoint com os workers concluindo fora de ordem:
+// só avança Done quando todos os números anteriores também terminaram
+type watermark struct {
+	mu       sync.Mutex
+	cacheDir string
+	cp       *downloadCheckpoint
+	pending  map[int]bool
+	unsaved  int
+}
+
+func (w *watermark) complete(n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if n <= w.cp.Done {
+		return
+	}
+	w.pending[n] = true
+	for w.pending[w.cp.Done+1] {
+		delete(w.pending, w.cp.Done+1)
+		w.cp.Done++
+	}
+	w.unsaved++
+	if w.unsaved >= checkpointEvery {
+		w.saveLocked()
+	}
+}
+
+func (w *watermark) save() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.saveLocked()
+}
+
+func (w *watermark) saveLocked() {
+	if err := saveCheckpoint(w.cacheDir, w.cp); err != nil {
+		fmt.Fprintf(os.Stderr, "warn: gravando checkpoint: %v\n", err)
+	}
+	w.unsaved = 0
+}
+
+// sweepTmpFiles remove arquivos .tmp deixados por uma execução interrompida
+// (no cache e em images/) e devolve quantos foram removidos
+func sweepTmpFiles(cacheDir string) (int, error) {
+	removed := 0
+	for _, dir := range []string{cacheDir, imagesDir(cacheDir)} {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+		if err != nil {
+			return removed, err
+		}
+		for _, m := range matches {
+			if err := os.Remove(m); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return removed, err
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// downloadOptions: ajustes de downloadAll e downloadImages
+type downloadOptions struct {
+	Workers     int
+	Recheck     bool // ignorar o checkpoint
+	RetryFailed bool // só tentar de novo os números de failed.json
+	Retry       retryPolicy
+}
+
+// downloadAll baixa os JSONs de 1..latest que ainda não estão no store,
+// retomando do checkpoint (a menos que Recheck), mais as falhas de execuções
+// anteriores; com RetryFailed, só essas. Toda falha vira uma entrada em
+// failed.json em vez de interromper o download; as restantes são devolvidas.
+// Se ctx for cancelado, para de enfileirar, grava o progresso e devolve ctx.Err().
+func downloadAll(ctx context.Context, f Fetcher, latest int, cacheDir string, cs comicStore, opts downloadOptions) ([]downloadFailure, error) {
+	failed, err := loadFailures(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("lendo %s: %w", failedFilename, err)
+	}
+	cp, err := loadCheckpoint(cacheDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warn: checkpoint ignorado: %v\n", err)
+	}
+	if opts.Recheck {
+		cp.Done = 0
+	}
+	if opts.RetryFailed {
+		fmt.Printf("Tentando de novo %d quadrinhos de %s\n", len(failed), failedFilename)
+	} else {
+		cp.Done = min(cp.Done, latest)
+	}
+	if !opts.RetryFailed && cp.Done > 0 {
+		fmt.Printf("Retomando a partir do quadrinho %d (checkpoint em %s)\n", cp.Done+1, checkpointFilename)
+	}
+	wm := &watermark{cacheDir: cacheDir, cp: cp, pending: map[int]bool{}}
+
+	type job struct{ n int }
+	jobs := make(chan job, opts.Workers*2)
+	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
+
+	// workers (o ritmo das requisições é dado pelo rate limiter do Fetcher)
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+				err := error(nil)
+				if !cs.Has(j.n) {
+					err = downloadComic(ctx, f, j.n, cs, opts.Retry)
+				}
+				if ctx.Err() != nil {
+					// interrompido: o número continua pendente
+					return
+				}
+				mu.Lock()
+				if err != nil {
+					failed[j.n] = newDownloadFailure(j.n, err)
+				} else {
+					delete(failed, j.n)
+				}
+				mu.Unlock()
+				// falhas também avançam o checkpoint: ficam registradas em failed.json
+				wm.complete(j.n)
+			}
+		}()
+	}
+
+	// enfileira: primeiro as falhas anteriores, depois os números novos
+	retry := sortedKeys(failed)
+	go func() {
+		defer close(jobs)
+		enqueue := func(n int) bool {
+			select {
+			case jobs <- job{n: n}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for _, n := range retry {
+			if !enqueue(n) {
+				return
+			}
+		}
+		if opts.RetryFailed {
+			return
+		}
+		for n := cp.Done + 1; n <= latest; n++ {
+			if !failedBefore(retry, n) && !enqueue(n) {
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	wm.save()
+	if err := saveFailures(cacheDir, failed); err != nil {
+		return nil, fmt.Errorf("gravando %s: %w", failedFilename, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]downloadFailure, 0, len(failed))
+	for _, n := range sortedKeys(failed) {
+		out = append(out, failed[n])
+	}
+	return out, nil
+}
+
+func failedBefore(retry []int, n int) bool {
+	i := sort.SearchInts(retry, n)
+	return i < len(retry) && retry[i] == n
+}
+
+func downloadComic(ctx context.Context, f Fetcher, n int, cs comicStore, retry retryPolicy) error {
+	var b []byte
+	err := retry.do(ctx, func() (err error) {
+		b, err = f.Comic(ctx, n)
+		return err
+	})
+	if errors.Is(err, errComicNotFound) {
+		fmt.Printf("quadrinho %d não existe (404) — ignorando\n", n)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return cs.Put(n, b)
+}
+
+// sleepCtx espera d ou até ctx ser cancelado; devolve false no cancelamento
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
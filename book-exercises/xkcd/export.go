@@ -0,0 +1,547 @@
+// export.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// defaultCloudTerms: quantos termos entram na nuvem de termos.html
+const defaultCloudTerms = 150
+
+// exportSearchLimit: máximo de resultados mostrados pela busca do site
+const exportSearchLimit = 50
+
+// exporter gera o site estático a partir do índice e do cache; nada vem da rede
+type exporter struct {
+	out    string
+	idx    *Index
+	images *imageManifest
+	imgDir string // images/ do cache
+
+	comics []*XKCD          // em ordem de número
+	years  map[string][]int // ano ("" = sem data) -> posições em comics
+	// written: arquivos (relativos a out) gravados nesta exportação; o que
+	// mais houver em comic/, year/ e images/ sobrou de exportações antigas
+	written map[string]bool
+	pruned  int
+}
+
+func exportCmd(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	cacheDir := fs.String("cache", filepath.Join(os.Getenv("HOME"), defaultCacheDirName), "diretório de cache")
+	htmlDir := fs.String("html", "", "diretório de saída do site estático")
+	cloud := fs.Int("terms", defaultCloudTerms, "quantos termos mostrar na nuvem de termos")
+	fs.Parse(args)
+
+	if *htmlDir == "" {
+		fmt.Fprintln(os.Stderr, "export: informe o diretório de saída com --html DIR")
+		usageAndExit()
+	}
+	idxPath := findIndexPath(*cacheDir)
+	index, err := loadIndex(idxPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro carregando índice (%s): %v\n", idxPath, err)
+		fmt.Fprintf(os.Stderr, "rodar `xkcd index --cache %s` primeiro\n", *cacheDir)
+		os.Exit(1)
+	}
+	cs, err := openStore(*cacheDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro abrindo o cache: %v\n", err)
+		os.Exit(1)
+	}
+	defer cs.Close()
+	images, err := loadImageManifest(*cacheDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warn: manifesto de imagens: %v\n", err)
+		images = &imageManifest{}
+	}
+
+	e := &exporter{out: *htmlDir, idx: index, images: images, imgDir: imagesDir(*cacheDir)}
+	if err := e.load(cs); err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Exportando %d quadrinhos para %s...\n", len(e.comics), e.out)
+	copied, err := e.run(*cloud)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		os.Exit(1)
+	}
+	if e.pruned > 0 {
+		fmt.Printf("Removidos %d arquivos de exportações anteriores\n", e.pruned)
+	}
+	fmt.Printf("Site gerado: %d páginas de quadrinhos, %d anos, %d imagens locais. Abra %s\n",
+		len(e.comics), len(e.years), copied, filepath.Join(e.out, "index.html"))
+}
+
+// load lê do store os quadrinhos indexados
+func (e *exporter) load(cs comicStore) error {
+	e.years = map[string][]int{}
+	for _, n := range e.idx.allNums() {
+		c, err := loadComic(cs, n)
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "warn: quadrinho %d está no índice mas não no cache\n", n)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("quadrinho %d: %w", n, err)
+		}
+		year := ""
+		if d := e.idx.Docs[n].Date; d != "" {
+			year = d[:4]
+		}
+		e.years[year] = append(e.years[year], len(e.comics))
+		e.comics = append(e.comics, c)
+	}
+	if len(e.comics) == 0 {
+		return errors.New("nenhum quadrinho para exportar")
+	}
+	return nil
+}
+
+// run grava o site, remove as páginas e imagens que sobraram de exportações
+// anteriores e devolve quantas imagens locais foram copiadas
+func (e *exporter) run(cloudTerms int) (int, error) {
+	e.written = map[string]bool{}
+	for _, d := range []string{"", "comic", "year", "images"} {
+		if err := os.MkdirAll(filepath.Join(e.out, d), 0o755); err != nil {
+			return 0, err
+		}
+	}
+	copied := 0
+	for i, c := range e.comics {
+		img, ok, err := e.copyImage(c.Num)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warn: imagem do quadrinho %d: %v\n", c.Num, err)
+		}
+		if ok {
+			copied++
+		} else {
+			img = c.Img
+		}
+		page := exportPage{View: "comic", Root: "../", Title: fmt.Sprintf("#%d %s", c.Num, c.Title),
+			Comic: c, Date: e.idx.Docs[c.Num].Date, Img: img, URL: comicURL(c.Num)}
+		if page.Date != "" {
+			page.Year = page.Date[:4]
+		}
+		if i > 0 {
+			page.Prev = e.comics[i-1].Num
+		}
+		if i+1 < len(e.comics) {
+			page.Next = e.comics[i+1].Num
+		}
+		if err := e.render(filepath.Join("comic", strconv.Itoa(c.Num)+".html"), page); err != nil {
+			return copied, err
+		}
+	}
+
+	years := sortedKeys(e.years)
+	for _, y := range years {
+		page := exportPage{View: "year", Root: "../", Title: "Quadrinhos de " + y, Year: y}
+		if y == "" {
+			page.Title = "Quadrinhos sem data"
+		}
+		for _, i := range e.years[y] {
+			c := e.comics[i]
+			page.List = append(page.List, exportItem{Num: c.Num, Title: c.Title, Date: e.idx.Docs[c.Num].Date})
+		}
+		if err := e.render(filepath.Join("year", yearPage(y)), page); err != nil {
+			return copied, err
+		}
+	}
+
+	home := exportPage{View: "home", Title: "xkcd", Total: len(e.comics)}
+	for _, y := range years {
+		home.Years = append(home.Years, exportYear{Year: y, Page: yearPage(y), Count: len(e.years[y])})
+	}
+	if err := e.render("index.html", home); err != nil {
+		return copied, err
+	}
+	if err := e.render("termos.html", exportPage{View: "terms", Title: "Termos", Cloud: e.cloud(cloudTerms)}); err != nil {
+		return copied, err
+	}
+	if err := e.writeSearchData(); err != nil {
+		return copied, err
+	}
+	return copied, e.prune()
+}
+
+// prune apaga de comic/, year/ e images/ o que esta exportação não gravou
+// (quadrinhos que saíram do índice, anos sem quadrinhos, imagens trocadas,
+// .tmp de uma exportação interrompida); o resto de out não é tocado
+func (e *exporter) prune() error {
+	for _, d := range []string{"comic", "year", "images"} {
+		ents, err := os.ReadDir(filepath.Join(e.out, d))
+		if err != nil {
+			return err
+		}
+		for _, ent := range ents {
+			rel := filepath.Join(d, ent.Name())
+			if ent.IsDir() || e.written[rel] {
+				continue
+			}
+			if err := os.Remove(filepath.Join(e.out, rel)); err != nil {
+				return err
+			}
+			e.pruned++
+		}
+	}
+	return nil
+}
+
+func yearPage(y string) string {
+	if y == "" {
+		return "sem-data.html"
+	}
+	return y + ".html"
+}
+
+// copyImage copia a imagem baixada do quadrinho para images/ do site (o nome
+// é o sha256, então uma cópia existente não muda) e devolve o caminho relativo
+// à página do quadrinho
+func (e *exporter) copyImage(num int) (string, bool, error) {
+	ent, ok := e.images.Images[num]
+	if !ok {
+		return "", false, nil
+	}
+	rel := filepath.Join("images", ent.File)
+	dst := filepath.Join(e.out, rel)
+	if _, err := os.Stat(dst); err != nil {
+		if err := copyFile(filepath.Join(e.imgDir, ent.File), dst); err != nil {
+			return "", false, err
+		}
+	}
+	e.written[rel] = true
+	return "../images/" + ent.File, true, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// cloudTerm: termo da nuvem, com a forma mais comum no texto e o tamanho (1-5)
+type cloudTerm struct {
+	Term, Label string
+	DF, Size    int
+}
+
+// cloud escolhe os limit termos presentes em mais quadrinhos (só campos de
+// texto) e os devolve em ordem alfabética do rótulo
+func (e *exporter) cloud(limit int) []cloudTerm {
+	var out []cloudTerm
+	for t, ps := range e.idx.Terms {
+		if df := textDF(ps); df > 0 {
+			out = append(out, cloudTerm{Term: t, Label: e.idx.label(t), DF: df})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].DF != out[j].DF {
+			return out[i].DF > out[j].DF
+		}
+		return out[i].Term < out[j].Term
+	})
+	out = out[:min(len(out), max(limit, 0))]
+	if len(out) == 0 {
+		return out
+	}
+	lo, hi := math.Log(float64(out[len(out)-1].DF)), math.Log(float64(out[0].DF))
+	for i := range out {
+		out[i].Size = 1
+		if hi > lo {
+			out[i].Size = 1 + int(4*(math.Log(float64(out[i].DF))-lo)/(hi-lo))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Label < out[j].Label })
+	return out
+}
+
+// textDF: em quantos quadrinhos o termo aparece em algum campo de texto
+func textDF(ps []Posting) int {
+	n := 0
+	for _, p := range ps {
+		for _, f := range textFields {
+			if len(p.Positions[f]) > 0 {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// exportSearchData: conteúdo de search-data.js, lido pela busca de index.html.
+// Terms traz, para cada termo, pares [número, frequência ponderada por
+// fieldWeights]; Words leva as palavras do índice (DocInfo.Words) aos termos,
+// então o stemming fica todo do lado do Go. FoldTable é a foldTable do
+// analisador, para o JS tirar acentos exatamente como normalize.
+type exportSearchData struct {
+	Fold      bool                 `json:"fold"`
+	FoldTable map[string]string    `json:"fold_table,omitempty"`
+	MinLen    int                  `json:"min_len"`
+	StopWords []string             `json:"stop_words"`
+	Docs      map[int][2]string    `json:"docs"` // número -> [título, data]
+	Terms     map[string][]float64 `json:"terms"`
+	Words     map[string]string    `json:"words"`
+}
+
+func (e *exporter) writeSearchData() error {
+	d := exportSearchData{
+		Fold:      e.idx.Analyzer.Fold,
+		MinLen:    e.idx.Analyzer.MinLen,
+		StopWords: e.idx.Analyzer.StopWords,
+		Docs:      map[int][2]string{},
+		Terms:     map[string][]float64{},
+		Words:     map[string]string{},
+	}
+	if d.StopWords == nil {
+		d.StopWords = []string{}
+	}
+	if d.Fold {
+		d.FoldTable = map[string]string{}
+		for r, f := range foldTable {
+			d.FoldTable[string(r)] = f
+		}
+	}
+	for _, c := range e.comics {
+		d.Docs[c.Num] = [2]string{c.Title, e.idx.Docs[c.Num].Date}
+	}
+	for t, ps := range e.idx.Terms {
+		var flat []float64
+		for _, p := range ps {
+			tf := 0.0
+			for f, pos := range p.Positions {
+				tf += fieldWeights[f] * float64(len(pos))
+			}
+			if _, ok := d.Docs[p.Num]; ok && tf > 0 {
+				flat = append(flat, float64(p.Num), math.Round(tf*10)/10)
+			}
+		}
+		if flat != nil {
+			d.Terms[t] = flat
+		}
+	}
+	s := e.idx.surfaces()
+	for i, w := range s.words {
+		if _, ok := d.Terms[s.terms[i]]; ok {
+			d.Words[w] = s.terms[i]
+		}
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	// .js em vez de .json: carregado por <script>, funciona também via file://
+	var buf bytes.Buffer
+	buf.WriteString("var XKCD_DATA = ")
+	buf.Write(b)
+	buf.WriteString(";\n")
+	return e.write("search-data.js", buf.Bytes())
+}
+
+// exportPage: dados de uma página do site; View escolhe o bloco do template
+type exportPage struct {
+	View, Title string
+	Root        string // prefixo até a raiz do site ("" ou "../")
+
+	Comic      *XKCD
+	Date, Year string
+	Img, URL   string
+	Prev, Next int
+
+	List  []exportItem
+	Total int
+	Years []exportYear
+	Cloud []cloudTerm
+	Limit int
+}
+
+type exportItem struct {
+	Num         int
+	Title, Date string
+}
+
+type exportYear struct {
+	Year, Page string
+	Count      int
+}
+
+func (e *exporter) render(rel string, p exportPage) error {
+	p.Limit = exportSearchLimit
+	var buf bytes.Buffer
+	if err := exportTemplate.Execute(&buf, p); err != nil {
+		return fmt.Errorf("%s: %w", rel, err)
+	}
+	return e.write(rel, buf.Bytes())
+}
+
+func (e *exporter) write(rel string, b []byte) error {
+	e.written[rel] = true
+	return writeExportFile(filepath.Join(e.out, rel), b)
+}
+
+func writeExportFile(path string, b []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+var exportTemplate = template.Must(template.New("site").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>{{.Title}}</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; background: #f5f5f5; }
+        .container { max-width: 900px; margin: 0 auto; background: white; padding: 20px; border-radius: 8px; }
+        h1 a { color: #333; text-decoration: none; }
+        input[type=text] { width: 60%; padding: 6px; }
+        .result { border-bottom: 1px solid #ddd; padding: 8px 0; }
+        .meta { color: #666; font-size: 0.9em; }
+        .nav a { margin-right: 15px; }
+        pre { white-space: pre-wrap; background: #f8f9fa; padding: 10px; }
+        img { max-width: 100%; }
+        .cloud a { margin: 0 6px; text-decoration: none; line-height: 2; }
+        .s1 { font-size: 0.8em; } .s2 { font-size: 1em; } .s3 { font-size: 1.3em; }
+        .s4 { font-size: 1.7em; } .s5 { font-size: 2.2em; font-weight: bold; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1><a href="{{.Root}}index.html">xkcd</a></h1>
+        <p class="nav"><a href="{{.Root}}index.html">busca</a> <a href="{{.Root}}termos.html">termos</a></p>
+        {{if eq .View "home"}}
+            <input type="text" id="q" placeholder="physics black hole" autofocus>
+            <p class="meta" id="info">{{.Total}} quadrinhos</p>
+            <div id="results"></div>
+            <h2>Por ano</h2>
+            <p class="nav">{{range .Years}}<a href="year/{{.Page}}">{{if .Year}}{{.Year}}{{else}}sem data{{end}}</a> <span class="meta">({{.Count}})</span> {{end}}</p>
+            <script src="search-data.js"></script>
+            <script>
+            (function() {
+                var D = XKCD_DATA, stop = {}, words = Object.keys(D.words);
+                D.stop_words.forEach(function(w) { stop[w] = true; });
+                var n = Object.keys(D.docs).length;
+                // o mesmo que normalize do Go: minúsculas e, se fold, foldTable
+                // nas letras acentuadas e marcas combinantes removidas
+                function fold(s) {
+                    s = s.toLowerCase();
+                    if (!D.fold) return s;
+                    return Array.from(s).map(function(c) {
+                        if (c < '\x80') return c;
+                        if (/\p{Mn}/u.test(c)) return '';
+                        return D.fold_table[c] || c;
+                    }).join('');
+                }
+                // termos do índice para uma palavra: a forma exata ou, se não
+                // houver, palavras que começam com ela
+                function lookup(w) {
+                    if (D.words[w]) return [D.words[w]];
+                    var out = [];
+                    if (w.length < 3) return out;
+                    for (var i = 0; i < words.length && out.length < 20; i++) {
+                        var t = D.words[words[i]];
+                        if (words[i].indexOf(w) === 0 && out.indexOf(t) < 0) out.push(t);
+                    }
+                    return out;
+                }
+                // termos da consulta combinados com AND; pontuação BM25 sem
+                // normalização por tamanho
+                function search(q) {
+                    var scores = null;
+                    var ws = fold(q).split(/[^\p{L}\p{N}\p{Mn}]+/u);
+                    for (var i = 0; i < ws.length; i++) {
+                        var w = ws[i];
+                        if (!w || stop[w] || Array.from(w).length < D.min_len) continue;
+                        var acc = {};
+                        lookup(w).forEach(function(t) {
+                            var ps = D.terms[t] || [], idf = Math.log(1 + (n - ps.length / 2 + 0.5) / (ps.length / 2 + 0.5));
+                            for (var j = 0; j < ps.length; j += 2) {
+                                acc[ps[j]] = (acc[ps[j]] || 0) + idf * ps[j + 1] * 2.2 / (ps[j + 1] + 1.2);
+                            }
+                        });
+                        if (scores === null) { scores = acc; continue; }
+                        var next = {};
+                        for (var k in scores) if (acc[k] !== undefined) next[k] = scores[k] + acc[k];
+                        scores = next;
+                    }
+                    if (scores === null) return null;
+                    return Object.keys(scores).sort(function(a, b) { return scores[b] - scores[a] || a - b; });
+                }
+                var box = document.getElementById('q'), info = document.getElementById('info'), res = document.getElementById('results');
+                function show() {
+                    var nums = search(box.value);
+                    res.textContent = '';
+                    if (nums === null) { info.textContent = n + ' quadrinhos'; return; }
+                    info.textContent = nums.length + ' resultado(s)' + (nums.length > {{.Limit}} ? ', mostrando {{.Limit}}' : '');
+                    nums.slice(0, {{.Limit}}).forEach(function(num) {
+                        var d = D.docs[num], div = document.createElement('div'), a = document.createElement('a'), m = document.createElement('span');
+                        div.className = 'result';
+                        a.href = 'comic/' + num + '.html';
+                        a.textContent = '#' + num + ' ' + d[0];
+                        m.className = 'meta';
+                        m.textContent = d[1] ? ' ' + d[1] : '';
+                        div.appendChild(a); div.appendChild(m); res.appendChild(div);
+                    });
+                }
+                box.addEventListener('input', show);
+                var q = new URLSearchParams(location.search).get('q');
+                if (q) { box.value = q; show(); }
+            })();
+            </script>
+        {{else if eq .View "comic"}}
+            {{with .Comic}}
+            <h2>#{{.Num}} {{.Title}}</h2>
+            <p class="meta">{{if $.Year}}<a href="../year/{{$.Year}}.html">{{$.Date}}</a>{{else}}sem data{{end}} | <a href="{{$.URL}}">xkcd.com</a></p>
+            <p><img src="{{$.Img}}" alt="{{.Alt}}" title="{{.Alt}}"></p>
+            <p><em>{{.Alt}}</em></p>
+            {{if .Transcript}}<pre>{{.Transcript}}</pre>{{end}}
+            {{end}}
+            <p class="nav">
+                {{if .Prev}}<a href="{{.Prev}}.html">&larr; #{{.Prev}}</a>{{end}}
+                {{if .Next}}<a href="{{.Next}}.html">#{{.Next}} &rarr;</a>{{end}}
+            </p>
+        {{else if eq .View "year"}}
+            <h2>{{.Title}}</h2>
+            {{range .List}}
+            <div class="result"><a href="../comic/{{.Num}}.html">#{{.Num}} {{.Title}}</a> <span class="meta">{{.Date}}</span></div>
+            {{end}}
+        {{else if eq .View "terms"}}
+            <h2>Termos mais frequentes</h2>
+            <p class="cloud">{{range .Cloud}}<a class="s{{.Size}}" href="index.html?q={{.Label}}" title="{{.DF}} quadrinhos">{{.Label}}</a> {{end}}</p>
+        {{end}}
+    </div>
+</body>
+</html>
+`))
@@ -0,0 +1,81 @@
+// export_test.go
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	cache := t.TempDir()
+	cs := &dirStore{dir: cache}
+	putComic(t, cs, XKCD{Num: 1, Title: "Physics", Alt: "Ørsted and Æsop at the café", Year: "2006", Month: "1", Day: "1"})
+	putComic(t, cs, XKCD{Num: 2, Title: "Purity", Alt: "physics is applied math", Year: "2007", Month: "2", Day: "3"})
+	idx, _, err := buildIndexFromCache(cs, testAnalyzer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// restos de uma exportação anterior com outros quadrinhos
+	out := t.TempDir()
+	for _, rel := range []string{"comic/999.html", "year/1999.html", "images/old.png", "comic/999.html.tmp", "notas.txt"} {
+		path := filepath.Join(out, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := &exporter{out: out, idx: idx, images: &imageManifest{}, imgDir: imagesDir(cache)}
+	if err := e.load(cs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.run(defaultCloudTerms); err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range []string{"comic/999.html", "year/1999.html", "images/old.png", "comic/999.html.tmp"} {
+		if _, err := os.Stat(filepath.Join(out, rel)); !os.IsNotExist(err) {
+			t.Errorf("%s continua no site (%v)", rel, err)
+		}
+	}
+	for _, rel := range []string{"index.html", "termos.html", "comic/1.html", "comic/2.html", "year/2007.html", "notas.txt"} {
+		if _, err := os.Stat(filepath.Join(out, rel)); err != nil {
+			t.Error(err)
+		}
+	}
+	if e.pruned != 4 {
+		t.Errorf("removidos %d, esperado 4", e.pruned)
+	}
+
+	b, err := os.ReadFile(filepath.Join(out, "search-data.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d exportSearchData
+	js := strings.TrimSuffix(strings.TrimPrefix(string(b), "var XKCD_DATA = "), ";\n")
+	if err := json.Unmarshal([]byte(js), &d); err != nil {
+		t.Fatal(err)
+	}
+	for w, term := range map[string]string{"physics": "physic", "orsted": idx.an.term("orsted"), "aesop": idx.an.term("aesop"), "cafe": idx.an.term("cafe")} {
+		if d.Words[w] != term {
+			t.Errorf("words[%q] = %q, esperado %q", w, d.Words[w], term)
+		}
+	}
+	for r, f := range foldTable {
+		if d.FoldTable[string(r)] != f {
+			t.Fatalf("fold_table[%q] = %q, esperado %q", r, d.FoldTable[string(r)], f)
+		}
+	}
+
+	cloud := e.cloud(defaultCloudTerms)
+	for _, c := range cloud {
+		if c.Label == "physic" || c.Label == "2006" {
+			t.Errorf("nuvem com %q", c.Label)
+		}
+	}
+}
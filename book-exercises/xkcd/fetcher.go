@@ -0,0 +1,208 @@
+// fetcher.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBaseURL   = "https://xkcd.com"
+	defaultUserAgent = "xkcd-index/1.0 (+https://github.com/fabiobatoni/desafios-go)"
+)
+
+// errComicNotFound: o quadrinho não existe na origem (ex.: o famoso #404)
+var errComicNotFound = errors.New("quadrinho não encontrado")
+
+// statusError: resposta HTTP inesperada da origem; RetryAfter vem do
+// cabeçalho Retry-After em 429/503
+type statusError struct {
+	Code       int
+	RetryAfter time.Duration
+}
+
+func (e *statusError) Error() string { return fmt.Sprintf("status %d", e.Code) }
+
+// Fetcher é a origem dos dados do xkcd usada por index: o site (HTTPFetcher),
+// um espelho local (DirFetcher) ou um servidor falso em testes
+type Fetcher interface {
+	// Latest devolve o JSON bruto do quadrinho mais recente
+	Latest(ctx context.Context) ([]byte, error)
+	// Comic devolve o JSON bruto do quadrinho n, ou errComicNotFound
+	Comic(ctx context.Context, n int) ([]byte, error)
+	// Image abre a imagem apontada pelo campo img de um quadrinho
+	Image(ctx context.Context, rawURL string) (io.ReadCloser, error)
+}
+
+// HTTPFetcher busca num servidor com a mesma API do xkcd.com. Toda requisição
+// passa pelo Limiter (compartilhado entre os workers), se houver.
+type HTTPFetcher struct {
+	BaseURL   string // ex.: https://xkcd.com (sem barra no final)
+	UserAgent string
+	Client    *http.Client
+	Limiter   *rateLimiter
+}
+
+func newHTTPFetcher(baseURL string, timeout time.Duration, userAgent string, limiter *rateLimiter) *HTTPFetcher {
+	return &HTTPFetcher{
+		BaseURL:   strings.TrimRight(baseURL, "/"),
+		UserAgent: userAgent,
+		Client:    &http.Client{Timeout: timeout},
+		Limiter:   limiter,
+	}
+}
+
+func (f *HTTPFetcher) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.UserAgent != "" {
+		req.Header.Set("User-Agent", f.UserAgent)
+	}
+	if err := f.Limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, errComicNotFound
+	}
+	resp.Body.Close()
+	se := &statusError{Code: resp.StatusCode}
+	if se.Code == http.StatusTooManyRequests || se.Code == http.StatusServiceUnavailable {
+		se.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		// o servidor pediu calma: pausa todos os workers, não só este
+		f.Limiter.pause(se.RetryAfter)
+	}
+	return nil, se
+}
+
+func (f *HTTPFetcher) getBytes(ctx context.Context, rawURL string) ([]byte, error) {
+	resp, err := f.get(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (f *HTTPFetcher) Latest(ctx context.Context) ([]byte, error) {
+	return f.getBytes(ctx, f.BaseURL+"/info.0.json")
+}
+
+func (f *HTTPFetcher) Comic(ctx context.Context, n int) ([]byte, error) {
+	return f.getBytes(ctx, fmt.Sprintf("%s/%d/info.0.json", f.BaseURL, n))
+}
+
+func (f *HTTPFetcher) Image(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	resp, err := f.get(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// DirFetcher lê de um espelho local com o mesmo layout do site:
+// DIR/info.0.json, DIR/N/info.0.json e imagens em DIR/<caminho da URL>
+// (ex.: DIR/comics/barrel_cropped_(1).jpg)
+type DirFetcher struct {
+	Dir string
+}
+
+func (f *DirFetcher) read(ctx context.Context, rel string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filepath.Join(f.Dir, filepath.FromSlash(rel)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errComicNotFound
+	}
+	return b, err
+}
+
+func (f *DirFetcher) Latest(ctx context.Context) ([]byte, error) { return f.read(ctx, "info.0.json") }
+
+func (f *DirFetcher) Comic(ctx context.Context, n int) ([]byte, error) {
+	return f.read(ctx, fmt.Sprintf("%d/info.0.json", n))
+}
+
+func (f *DirFetcher) Image(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	// limpar a partir de "/" impede escapar do diretório com ".."
+	rel := strings.TrimPrefix(path.Clean("/"+u.Path), "/")
+	rc, err := os.Open(filepath.Join(f.Dir, filepath.FromSlash(rel)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errComicNotFound
+	}
+	return rc, err
+}
+
+// fetchFlags: flags de origem e ritmo dos downloads, comuns a index e verify
+type fetchFlags struct {
+	baseURL   string
+	mirror    string
+	timeout   time.Duration
+	userAgent string
+	rate      float64
+	retry     retryPolicy
+}
+
+func registerFetchFlags(fs *flag.FlagSet) *fetchFlags {
+	ff := &fetchFlags{retry: defaultRetryPolicy()}
+	fs.StringVar(&ff.baseURL, "base-url", defaultBaseURL, "URL base da API do xkcd (ex.: um espelho ou servidor de testes)")
+	fs.StringVar(&ff.mirror, "mirror", "", "ler de um espelho local (DIR/info.0.json, DIR/N/info.0.json) em vez de HTTP")
+	fs.DurationVar(&ff.timeout, "timeout", 20*time.Second, "timeout de cada requisição HTTP")
+	fs.StringVar(&ff.userAgent, "user-agent", defaultUserAgent, "User-Agent enviado nas requisições HTTP")
+	fs.Float64Var(&ff.rate, "rate", 5, "máximo de requisições HTTP por segundo, somando todos os workers (0 = sem limite)")
+	fs.IntVar(&ff.retry.Retries, "retries", ff.retry.Retries, "novas tentativas por requisição que falhar (rede, 429, 5xx)")
+	fs.DurationVar(&ff.retry.BaseDelay, "retry-delay", ff.retry.BaseDelay, "espera antes da 1ª nova tentativa; dobra a cada tentativa, com jitter")
+	fs.DurationVar(&ff.retry.MaxDelay, "max-retry-delay", ff.retry.MaxDelay, "teto da espera entre tentativas")
+	return ff
+}
+
+func (ff *fetchFlags) fetcher() Fetcher {
+	if ff.mirror != "" {
+		return &DirFetcher{Dir: ff.mirror}
+	}
+	return newHTTPFetcher(ff.baseURL, ff.timeout, ff.userAgent, newRateLimiter(ff.rate, 1))
+}
+
+// fetchLatestNum pega o número do quadrinho mais recente na origem
+func fetchLatestNum(ctx context.Context, f Fetcher) (int, error) {
+	b, err := f.Latest(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var c XKCD
+	if err := json.Unmarshal(b, &c); err != nil {
+		return 0, err
+	}
+	if c.Num == 0 {
+		return 0, errors.New("num zero no latest")
+	}
+	return c.Num, nil
+}
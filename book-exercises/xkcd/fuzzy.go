@@ -0,0 +1,165 @@
+// fuzzy.go
+package main
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// maxFuzzy: maior distância aceita em --fuzzy (acima disso quase tudo casa)
+const maxFuzzy = 3
+
+// damerauLevenshtein: distância de edição com inserção, remoção, troca e
+// transposição de runes vizinhas (variante "optimal string alignment")
+func damerauLevenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+// bkTree indexa o vocabulário por distância de edição: cada filho fica na
+// aresta com a sua distância até o pai, o que permite podar a busca pela
+// desigualdade triangular
+type bkTree struct {
+	root *bkNode
+}
+
+type bkNode struct {
+	term     string
+	children map[int]*bkNode
+}
+
+func newBKTree(terms []string) *bkTree {
+	t := &bkTree{}
+	for _, term := range terms {
+		t.add(term)
+	}
+	return t
+}
+
+func (t *bkTree) add(term string) {
+	if t.root == nil {
+		t.root = &bkNode{term: term}
+		return
+	}
+	n := t.root
+	for {
+		d := damerauLevenshtein(term, n.term)
+		if d == 0 {
+			return
+		}
+		child, ok := n.children[d]
+		if !ok {
+			if n.children == nil {
+				n.children = map[int]*bkNode{}
+			}
+			n.children[d] = &bkNode{term: term}
+			return
+		}
+		n = child
+	}
+}
+
+// fuzzyMatch: termo do vocabulário e sua distância até o termo buscado
+type fuzzyMatch struct {
+	Term string
+	Dist int
+}
+
+// search devolve os termos a no máximo maxDist de term, do mais próximo ao mais distante
+func (t *bkTree) search(term string, maxDist int) []fuzzyMatch {
+	var out []fuzzyMatch
+	if t.root == nil {
+		return nil
+	}
+	stack := []*bkNode{t.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		d := damerauLevenshtein(term, n.term)
+		if d <= maxDist {
+			out = append(out, fuzzyMatch{Term: n.term, Dist: d})
+		}
+		for cd, child := range n.children {
+			if cd >= d-maxDist && cd <= d+maxDist {
+				stack = append(stack, child)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Dist != out[j].Dist {
+			return out[i].Dist < out[j].Dist
+		}
+		return out[i].Term < out[j].Term
+	})
+	return out
+}
+
+// vocab devolve a BK-tree do vocabulário do índice (construída na primeira chamada)
+func (idx *Index) vocab() *bkTree {
+	idx.vocabOnce.Do(func() {
+		idx.bk = newBKTree(sortedKeys(idx.Terms))
+	})
+	return idx.bk
+}
+
+// fuzzyTerms: termos do índice a no máximo dist de term. Termos com até dist
+// runes não são expandidos (casariam com quase qualquer coisa).
+func (idx *Index) fuzzyTerms(term string, dist int) []string {
+	if dist <= 0 || utf8.RuneCountInString(term) <= dist {
+		return []string{term}
+	}
+	var out []string
+	for _, m := range idx.vocab().search(term, dist) {
+		out = append(out, m.Term)
+	}
+	if len(out) == 0 {
+		return []string{term}
+	}
+	return out
+}
+
+// suggest devolve até limit termos do índice parecidos com term (que não
+// existe no índice), priorizando menor distância e depois termos mais comuns
+func (idx *Index) suggest(term string, limit int) []string {
+	dist := 1
+	if n := utf8.RuneCountInString(term); n >= 8 {
+		dist = 3
+	} else if n >= 5 {
+		dist = 2
+	}
+	ms := idx.vocab().search(term, dist)
+	sort.SliceStable(ms, func(i, j int) bool {
+		if ms[i].Dist != ms[j].Dist {
+			return ms[i].Dist < ms[j].Dist
+		}
+		return len(idx.Terms[ms[i].Term]) > len(idx.Terms[ms[j].Term])
+	})
+	var out []string
+	for _, m := range ms {
+		if len(out) == limit {
+			break
+		}
+		out = append(out, m.Term)
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+// fuzzy_test.go
+package main
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// sugestões e expansões aproximadas mostram a palavra digitada e as palavras
+// dos quadrinhos, nunca os termos (physics -> physic)
+func TestFuzzyShowsSurfaceWords(t *testing.T) {
+	idx := newIndex(testAnalyzer(t))
+	idx.addComic(&XKCD{Num: 1, Title: "Purity", Alt: "physics is just applied math"})
+	idx.addComic(&XKCD{Num: 2, Title: "Physics", Alt: "more physics"})
+	idx.finish()
+
+	resp, err := idx.search("Physcs", searchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 0 {
+		t.Fatalf("%d resultados sem fuzzy", len(resp.Results))
+	}
+	if got := resp.Suggestions["Physcs"]; !slices.Equal(got, []string{"physics"}) {
+		t.Fatalf("sugestões = %v", resp.Suggestions)
+	}
+
+	var out bytes.Buffer
+	sh := &shell{index: idx, out: &out, perPage: 10}
+	sh.run("Physcs")
+	if want := "Você quis dizer (Physcs): physics\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("saída do shell:\n%s\nesperado %q", out.String(), want)
+	}
+
+	resp, err = idx.search("title:physcs", searchOptions{Fuzzy: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 1 || resp.Results[0].Num != 2 {
+		t.Fatalf("resultados = %+v", resp.Results)
+	}
+	if got := resp.Expanded["physcs"]; !slices.Equal(got, []string{"physics"}) {
+		t.Errorf("expandido = %v", resp.Expanded)
+	}
+}
@@ -0,0 +1,216 @@
+// images.go
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	imagesDirName      = "images"
+	imagesManifestName = "manifest.json"
+)
+
+// imageEntry: imagem de um quadrinho no cache. Arquivos são nomeados pelo
+// sha256 do conteúdo, então quadrinhos com a mesma imagem dividem o arquivo.
+type imageEntry struct {
+	URL    string `json:"url"`
+	File   string `json:"file"` // relativo a images/
+	SHA256 string `json:"sha256"`
+}
+
+// imageManifest: número do quadrinho -> imagem baixada (images/manifest.json)
+type imageManifest struct {
+	Images map[int]imageEntry `json:"images"`
+}
+
+func imagesDir(cacheDir string) string { return filepath.Join(cacheDir, imagesDirName) }
+
+func loadImageManifest(cacheDir string) (*imageManifest, error) {
+	m := &imageManifest{Images: map[int]imageEntry{}}
+	b, err := os.ReadFile(filepath.Join(imagesDir(cacheDir), imagesManifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+	if m.Images == nil {
+		m.Images = map[int]imageEntry{}
+	}
+	return m, nil
+}
+
+func saveImageManifest(cacheDir string, m *imageManifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(imagesDir(cacheDir), imagesManifestName)
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// localImage devolve o caminho (relativo ao cache) da imagem baixada do
+// quadrinho, ou "" se ela não estiver no cache
+func (m *imageManifest) localImage(num int) string {
+	if m == nil {
+		return ""
+	}
+	e, ok := m.Images[num]
+	if !ok {
+		return ""
+	}
+	return filepath.Join(imagesDirName, e.File)
+}
+
+// downloadImages baixa a imagem de cada quadrinho do cache que ainda não
+// esteja no manifesto. Falhas individuais não interrompem as demais; o
+// número de falhas é devolvido junto com o erro da última.
+func downloadImages(ctx context.Context, f Fetcher, cacheDir string, cs comicStore, opts downloadOptions) (downloaded, failed int, err error) {
+	dir := imagesDir(cacheDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, 0, err
+	}
+	m, err := loadImageManifest(cacheDir)
+	if err != nil {
+		return 0, 0, fmt.Errorf("manifesto de imagens: %w", err)
+	}
+	nums, err := storeNums(cs)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	type job struct {
+		n   int
+		url string
+	}
+	jobs := make(chan job, opts.Workers*2)
+	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
+	var lastErr error
+
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+				e, err := downloadImage(ctx, f, j.url, dir, opts.Retry)
+				mu.Lock()
+				switch {
+				case ctx.Err() != nil:
+					// interrompido: não conta como falha
+				case err != nil:
+					failed++
+					lastErr = fmt.Errorf("imagem do quadrinho %d: %w", j.n, err)
+					fmt.Fprintf(os.Stderr, "warn: %v\n", lastErr)
+				default:
+					m.Images[j.n] = e
+					downloaded++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, n := range nums {
+		c, err := loadComic(cs, n)
+		if err != nil || c.Img == "" {
+			continue
+		}
+		if e, ok := m.Images[n]; ok && e.URL == c.Img {
+			if _, err := os.Stat(filepath.Join(dir, e.File)); err == nil {
+				continue
+			}
+		}
+		select {
+		case jobs <- job{n: n, url: c.Img}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	// o manifesto é gravado mesmo se interrompido, guardando o que já baixou
+	if err := saveImageManifest(cacheDir, m); err != nil {
+		return downloaded, failed, err
+	}
+	if err := ctx.Err(); err != nil {
+		return downloaded, failed, err
+	}
+	return downloaded, failed, lastErr
+}
+
+// downloadImage baixa a URL (via Fetcher) para um arquivo temporário em dir
+// calculando o sha256 e então o renomeia para <sha256><ext>; se já existir um
+// arquivo com o mesmo conteúdo, o temporário é descartado
+func downloadImage(ctx context.Context, fetcher Fetcher, rawURL, dir string, retry retryPolicy) (imageEntry, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return imageEntry{}, err
+	}
+	ext := path.Ext(u.Path)
+	if ext == "" {
+		ext = ".img"
+	}
+
+	var e imageEntry
+	err = retry.do(ctx, func() (err error) {
+		e, err = func() (imageEntry, error) {
+			body, err := fetcher.Image(ctx, rawURL)
+			if err != nil {
+				return imageEntry{}, err
+			}
+			defer body.Close()
+			f, err := os.CreateTemp(dir, "download-*.tmp")
+			if err != nil {
+				return imageEntry{}, err
+			}
+			tmp := f.Name()
+			h := sha256.New()
+			_, err = io.Copy(io.MultiWriter(f, h), body)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(tmp)
+				return imageEntry{}, err
+			}
+			sum := hex.EncodeToString(h.Sum(nil))
+			name := sum + ext
+			final := filepath.Join(dir, name)
+			if _, err := os.Stat(final); err == nil {
+				// conteúdo já baixado para outro quadrinho
+				os.Remove(tmp)
+			} else if err := os.Rename(tmp, final); err != nil {
+				os.Remove(tmp)
+				return imageEntry{}, err
+			}
+			return imageEntry{URL: rawURL, File: name, SHA256: sum}, nil
+		}()
+		return err
+	})
+	return e, err
+}
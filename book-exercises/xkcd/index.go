@@ -0,0 +1,358 @@
+// index.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// campos indexados de cada quadrinho
+const (
+	fieldTitle      = "title"
+	fieldSafeTitle  = "safe_title"
+	fieldAlt        = "alt"
+	fieldTranscript = "transcript"
+	fieldYear       = "year"
+)
+
+// textFields: campos de texto, buscados por termos sem prefixo
+var textFields = []string{fieldTitle, fieldSafeTitle, fieldAlt, fieldTranscript}
+
+var indexedFields = append(slices.Clone(textFields), fieldYear)
+
+// fieldScopes: prefixos aceitos na consulta (title:, alt:, ...) -> campos
+// buscados. O escopo "" (termo sem prefixo) é textFields.
+var fieldScopes = map[string][]string{
+	"title":      {fieldTitle, fieldSafeTitle},
+	"alt":        {fieldAlt},
+	"transcript": {fieldTranscript},
+	"year":       {fieldYear},
+}
+
+// scopeFields devolve os campos de um escopo de consulta
+func scopeFields(scope string) []string {
+	if scope == "" {
+		return textFields
+	}
+	return fieldScopes[scope]
+}
+
+// inScope: o campo f é buscado pelo escopo?
+func inScope(scope, f string) bool { return slices.Contains(scopeFields(scope), f) }
+
+// fieldWeights: peso de cada campo no ranking (título vale mais que
+// transcrição; year só filtra e não pontua)
+var fieldWeights = map[string]float64{
+	fieldTitle:      3.0,
+	fieldSafeTitle:  3.0,
+	fieldAlt:        1.5,
+	fieldTranscript: 1.0,
+}
+
+// Posting: ocorrência de um termo em um quadrinho, com as posições (índice do
+// token dentro do campo, crescentes) em cada campo
+type Posting struct {
+	Num       int              `json:"num"`
+	Positions map[string][]int `json:"positions"`
+}
+
+// freq: quantas vezes o termo aparece no campo
+func (p *Posting) freq(field string) int { return len(p.Positions[field]) }
+
+// DocInfo guarda o tamanho (em tokens) de cada campo do quadrinho, a data de
+// publicação (AAAA-MM-DD, "" se a API não trouxe) e as palavras distintas do
+// quadrinho como aparecem no texto (normalizadas, antes do stemming; ver surfaces)
+type DocInfo struct {
+	Lens  map[string]int `json:"lens"`
+	Date  string         `json:"date,omitempty"`
+	Words []string       `json:"words,omitempty"`
+}
+
+// indexVersion muda sempre que o formato do índice muda de forma incompatível
+const indexVersion = 6
+
+// Índice invertido posicional: token -> postings (ordenados por Num) + estatísticas dos documentos
+type Index struct {
+	Version  int                  `json:"version"`
+	Analyzer AnalyzerConfig       `json:"analyzer"`
+	Docs     map[int]*DocInfo     `json:"docs"`
+	Terms    map[string][]Posting `json:"terms"`
+
+	an *Analyzer // construído a partir de Analyzer; usado na indexação e na busca
+
+	vocabOnce sync.Once
+	bk        *bkTree // vocabulário para busca aproximada (ver vocab)
+	surfOnce  sync.Once
+	surf      *surfaceIndex // palavras dos quadrinhos, para curingas e exibição (ver surfaces)
+}
+
+func newIndex(an *Analyzer) *Index {
+	return &Index{
+		Version:  indexVersion,
+		Analyzer: an.cfg,
+		Docs:     make(map[int]*DocInfo),
+		Terms:    make(map[string][]Posting),
+		an:       an,
+	}
+}
+
+func comicFields(c *XKCD) map[string]string {
+	return map[string]string{
+		fieldTitle:      c.Title,
+		fieldSafeTitle:  c.SafeTitle,
+		fieldAlt:        c.Alt,
+		fieldTranscript: c.Transcript,
+		fieldYear:       c.Year,
+	}
+}
+
+// addComic analisa cada campo do quadrinho e acrescenta suas postings ao índice.
+// As listas ficam fora de ordem até chamar finish.
+func (idx *Index) addComic(c *XKCD) {
+	doc := &DocInfo{Lens: make(map[string]int), Date: comicDate(c)}
+	positions := map[string]map[string][]int{} // termo -> campo -> posições
+	words := map[string]bool{}
+	for field, text := range comicFields(c) {
+		toks := idx.an.Analyze(text)
+		if len(toks) > 0 {
+			doc.Lens[field] = len(toks)
+		}
+		for _, t := range toks {
+			words[idx.an.normalize(text[t.Start:t.End])] = true
+			if positions[t.Term] == nil {
+				positions[t.Term] = map[string][]int{}
+			}
+			positions[t.Term][field] = append(positions[t.Term][field], t.Pos)
+		}
+	}
+	doc.Words = sortedKeys(words)
+	idx.Docs[c.Num] = doc
+	for t, p := range positions {
+		idx.Terms[t] = append(idx.Terms[t], Posting{Num: c.Num, Positions: p})
+	}
+}
+
+// finish ordena as postings de cada termo por número do quadrinho
+func (idx *Index) finish() {
+	for _, ps := range idx.Terms {
+		sort.Slice(ps, func(i, j int) bool { return ps[i].Num < ps[j].Num })
+	}
+}
+
+// posting devolve a posting do termo no quadrinho num (busca binária), ou nil
+func (idx *Index) posting(term string, num int) *Posting {
+	ps := idx.Terms[term]
+	i := sort.Search(len(ps), func(i int) bool { return ps[i].Num >= num })
+	if i < len(ps) && ps[i].Num == num {
+		return &ps[i]
+	}
+	return nil
+}
+
+// postingNums devolve os números dos quadrinhos que contêm o termo (já ordenados)
+func (idx *Index) postingNums(term string) []int {
+	ps := idx.Terms[term]
+	out := make([]int, len(ps))
+	for i, p := range ps {
+		out[i] = p.Num
+	}
+	return out
+}
+
+// postingNumsIn: como postingNums, mas só quadrinhos em que o termo aparece
+// em algum campo do escopo
+func (idx *Index) postingNumsIn(term, scope string) []int {
+	var out []int
+	for _, p := range idx.Terms[term] {
+		for f := range p.Positions {
+			if inScope(scope, f) {
+				out = append(out, p.Num)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// buildIndexFromCache lê os quadrinhos do store e constroi o índice
+// invertido do zero, junto com os metadados para atualizações incrementais
+func buildIndexFromCache(cs comicStore, an *Analyzer) (*Index, *indexMeta, error) {
+	idx, meta := newIndex(an), newIndexMeta()
+	if _, err := updateIndexFromCache(cs, idx, meta); err != nil {
+		return nil, nil, err
+	}
+	return idx, meta, nil
+}
+
+// removeDoc tira o quadrinho do índice (todas as postings e estatísticas)
+func (idx *Index) removeDoc(num int) {
+	if _, ok := idx.Docs[num]; !ok {
+		return
+	}
+	delete(idx.Docs, num)
+	for t, ps := range idx.Terms {
+		i := sort.Search(len(ps), func(i int) bool { return ps[i].Num >= num })
+		if i == len(ps) || ps[i].Num != num {
+			continue
+		}
+		ps = append(ps[:i], ps[i+1:]...)
+		if len(ps) == 0 {
+			delete(idx.Terms, t)
+		} else {
+			idx.Terms[t] = ps
+		}
+	}
+}
+
+// comicFileName: nome do JSON do quadrinho n no cache (e chave nos metadados)
+func comicFileName(n int) string {
+	return fmt.Sprintf("%d.json", n)
+}
+
+// comicNumFromName: "123.json" -> 123; outros arquivos do cache (índice, metadados) -> false
+func comicNumFromName(name string) (int, bool) {
+	base, ok := strings.CutSuffix(name, ".json")
+	if !ok || base == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(base)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// saveIndex grava o índice no formato indicado pela extensão (.bin ou .json)
+func saveIndex(path string, idx *Index) error {
+	if filepath.Ext(path) == ".bin" {
+		return saveIndexBinary(path, idx)
+	}
+	b, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func loadIndex(path string) (*Index, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var idx *Index
+	if isBinaryIndex(b) {
+		if idx, err = decodeIndexBinary(b); err != nil {
+			return nil, err
+		}
+	} else {
+		idx = &Index{}
+		if err := json.Unmarshal(b, idx); err != nil {
+			return nil, err
+		}
+	}
+	if idx.Version != indexVersion || idx.Docs == nil || idx.Terms == nil {
+		return nil, fmt.Errorf("formato de índice antigo ou inválido; rode `xkcd index --rebuild`")
+	}
+	if idx.an, err = newAnalyzer(idx.Analyzer); err != nil {
+		return nil, fmt.Errorf("analisador gravado no índice: %w", err)
+	}
+	return idx, nil
+}
+
+// indexPaths devolve os caminhos do índice em cada formato suportado
+func indexPaths(cacheDir string) map[string]string {
+	return map[string]string{
+		"json": filepath.Join(cacheDir, indexFilename),
+		"bin":  filepath.Join(cacheDir, indexBinFilename),
+	}
+}
+
+// findIndexPath localiza o índice do cache (o mais recente, se houver os dois
+// formatos); sem índice, devolve o caminho JSON para a mensagem de erro
+func findIndexPath(cacheDir string) string {
+	best := filepath.Join(cacheDir, indexFilename)
+	var bestTime time.Time
+	for _, p := range indexPaths(cacheDir) {
+		if info, err := os.Stat(p); err == nil && info.ModTime().After(bestTime) {
+			best, bestTime = p, info.ModTime()
+		}
+	}
+	return best
+}
+
+// allNums devolve todos os quadrinhos indexados, em ordem crescente
+func (idx *Index) allNums() []int {
+	out := make([]int, 0, len(idx.Docs))
+	for n := range idx.Docs {
+		out = append(out, n)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// operações de conjunto sobre listas ordenadas de números de quadrinhos
+
+func intersectSorted(a, b []int) []int {
+	var out []int
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+func unionSorted(a, b []int) []int {
+	out := make([]int, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j >= len(b) || (i < len(a) && a[i] < b[j]):
+			out = append(out, a[i])
+			i++
+		case i >= len(a) || b[j] < a[i]:
+			out = append(out, b[j])
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+func differenceSorted(a, b []int) []int {
+	var out []int
+	j := 0
+	for _, v := range a {
+		for j < len(b) && b[j] < v {
+			j++
+		}
+		if j < len(b) && b[j] == v {
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
@@ -2,20 +2,19 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"io/fs"
-	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
-	"sort"
+	"slices"
 	"strings"
-	"sync"
-	"time"
+	"syscall"
+	"text/template"
 )
 
 // Estrutura simplificada do JSON do xkcd (campos que vamos usar)
@@ -30,18 +29,17 @@ type XKCD struct {
 	Alt        string `json:"alt"`
 	Img        string `json:"img"`
 	Title      string `json:"title"`
+	Day        string `json:"day"`
 }
 
 const (
 	defaultCacheDirName = ".xkcd-cache"
 	indexFilename       = "index.json"
+	indexBinFilename    = "index.bin"
 )
 
-// Tipo do índice: token -> []int (lista de números dos quadrinhos)
-type Index map[string][]int
-
 func main() {
-	// subcomandos: index e search
+	// subcomandos: index, search, shell, similar, serve, show, random, latest, verify, migrate e export
 	if len(os.Args) < 2 {
 		usageAndExit()
 	}
@@ -52,6 +50,24 @@ func main() {
 		indexCmd(os.Args[2:])
 	case "search":
 		searchCmd(os.Args[2:])
+	case "shell":
+		shellCmd(os.Args[2:])
+	case "similar":
+		similarCmd(os.Args[2:])
+	case "serve":
+		serveCmd(os.Args[2:])
+	case "show":
+		showCmd(os.Args[2:])
+	case "random":
+		randomCmd(os.Args[2:])
+	case "latest":
+		latestCmd(os.Args[2:])
+	case "verify":
+		verifyCmd(os.Args[2:])
+	case "migrate":
+		migrateCmd(os.Args[2:])
+	case "export":
+		exportCmd(os.Args[2:])
 	default:
 		fmt.Fprintf(os.Stderr, "comando desconhecido: %s\n\n", cmd)
 		usageAndExit()
@@ -59,16 +75,121 @@ func main() {
 }
 
 func usageAndExit() {
-	fmt.Println(`Uso:
-  xkcd index [--cache DIR] [--workers N] [--rebuild]
+	fmt.Print(`Uso:
+  xkcd index [--cache DIR] [--workers N] [--rebuild] [--format json|bin] [--images]
+             [--base-url URL | --mirror DIR] [--timeout D] [--user-agent UA] [--recheck] [--retry-failed]
+             [--rate N] [--retries N] [--retry-delay D] [--max-retry-delay D]
     Baixa (uma vez) todos os JSON do xkcd e cria/atualiza o índice invertido.
-
-  xkcd search [--cache DIR] TERM [TERM ...]
-    Busca TERM(s) no índice e exibe URL + transcrição dos quadrinhos que casam.
+    Só quadrinhos novos ou alterados desde a última execução são reindexados
+    (metadados em index.meta.json); --rebuild força a reconstrução completa.
+    --format bin grava index.bin (compacto, postings delta/varint com checksum)
+    em vez de index.json; search detecta o formato sozinho.
+    Análise do texto: palavras Unicode, acentos removidos (--no-fold mantém),
+    stop words (--stopwords en|pt|none|ARQUIVO[,...]) e stemming
+    (--stemmer english|portuguese|none). A configuração fica gravada no
+    índice e é usada também na busca; mudá-la força a reconstrução.
+    --images baixa as imagens para images/ (nome = sha256 do conteúdo, sem
+    duplicatas); search, show e serve passam a apontar para a cópia local.
+    Origem: --base-url URL (padrão https://xkcd.com; também --timeout e
+    --user-agent) ou --mirror DIR, um espelho local com o layout do site
+    (DIR/info.0.json, DIR/N/info.0.json, imagens em DIR/comics/...).
+    Ctrl-C interrompe de forma limpa: o progresso fica em
+    download.checkpoint.json e a próxima execução continua de onde parou
+    (--recheck confere tudo de novo); .tmp deixados para trás são removidos.
+    Ritmo: --rate N requisições/s no total (padrão 5); falhas de rede, 429 e
+    5xx são repetidas até --retries vezes com backoff exponencial e jitter
+    (--retry-delay, --max-retry-delay), respeitando Retry-After.
+    Quadrinhos que falharem não interrompem os demais: vão para failed.json
+    no cache, o comando termina com erro e um resumo, e a próxima execução
+    (ou --retry-failed, só com eles) tenta de novo.
+
+  xkcd search [--cache DIR] [--fuzzy N] [--max-expansions N]
+              [--since DATA] [--until DATA] [--sort relevance|date|num]
+              [--snippet-len N | --full] [--synonyms ARQUIVO | --no-synonyms]
+              [--format text|json|ndjson|csv|md | --template TMPL] [--] CONSULTA ...
+    Busca no índice e exibe URL + transcrição dos quadrinhos que casam,
+    ordenados por relevância (BM25; título pesa mais que alt e transcrição).
+    Termos separados por espaço são combinados com AND; também aceita
+    OR, AND, NOT/-termo, "frase entre aspas", a NEAR/n b (proximidade no
+    mesmo campo) e parênteses (NEAR > NOT > AND > OR).
+    Prefixos title:, alt:, transcript: e year: restringem um termo, frase,
+    curinga ou grupo a um campo (alt:"hover text", title:(git OR svn),
+    year:2015); termos sem prefixo buscam título, alt e transcrição.
+    Cada resultado mostra um trecho de até --snippet-len caracteres em volta
+    dos termos encontrados, destacados no terminal (**negrito** com
+    --format md); --full mostra a transcrição/alt inteira.
+    Sinônimos: cada linha de synonyms.txt no cache (ou de --synonyms) é um
+    grupo de termos ou frases equivalentes separados por vírgula, p.ex.
+    "sql, database, db" ou "ai, artificial intelligence"; a busca por
+    qualquer um deles procura todos (inclusive frases digitadas sem aspas).
+    --no-synonyms desliga a expansão.
+    --since/--until (AAAA, AAAA-MM ou AAAA-MM-DD, inclusivos) filtram pela
+    data de publicação; --sort date ou num troca a ordem por relevância
+    pela cronológica ou pelo número.
+    Curingas (quant*, *bit*, c?t) expandem para termos do índice, até
+    --max-expansions por padrão; os termos usados são informados.
+    --fuzzy N aceita termos a até N edições de distância; sem resultados,
+    sugere termos parecidos do índice. Use -- antes de uma consulta que
+    comece com -termo.
+    --format json|ndjson|csv|md gera saída para outras ferramentas, sempre
+    com num, title, date, url, img, score, matched_fields (campos onde a
+    consulta casou) e snippet; --template aplica um text/template a cada resultado,
+    com esses campos e .Comic (o quadrinho inteiro), p.ex.
+    '{{.Num}} {{join .Fields ","}}'.
+
+  xkcd shell [--cache DIR] [--page-size N] [--fuzzy N] [--sort relevance|date|num]
+             [--snippet-len N] [--synonyms ARQUIVO | --no-synonyms]
+    Carrega o índice uma vez e aceita consultas interativamente, com a mesma
+    sintaxe de search. Resultados vêm em páginas (Enter ou :next avança,
+    :prev volta, :page N); :show N exibe um quadrinho inteiro, :open [N]
+    imprime a URL, :sort e :fuzzy mudam a busca atual. As consultas ficam em
+    shell_history no cache (:history lista, !N repete); :help, :quit.
+
+  xkcd similar [--cache DIR] [--limit K] NUM
+    Lista os K (padrão 10) quadrinhos mais parecidos com NUM: vetores TF-IDF
+    montados a partir do índice (título pesa mais, como na busca) comparados
+    por similaridade de cosseno, com os termos em comum que mais pesaram.
+    Funciona só com o cache local.
+
+  xkcd serve [--cache DIR] [--addr HOST:PORTA] [--synonyms ARQUIVO | --no-synonyms]
+    Carrega o índice uma vez e serve a busca via HTTP, só a partir do cache:
+    /api/search?q=CONSULTA[&fuzzy=N&offset=N&limit=N], /api/comic/{num},
+    /api/similar/{num}[?limit=K], e uma interface HTML em / e /comic/{num}
+    (com os quadrinhos parecidos). Os sinônimos são os mesmos de search.
+
+  xkcd show [--cache DIR] [--open|--json] NUM
+  xkcd random [--cache DIR] [--open|--json]
+  xkcd latest [--cache DIR] [--open|--json]
+    Exibe um quadrinho do cache: pelo número, um aleatório ou o mais recente.
+    --open imprime só a URL; --json imprime o JSON do quadrinho.
+
+  xkcd verify [--cache DIR] [--latest N] [--repair] [opções de origem do index]
+    Confere 1..N no cache (N = maior número no cache, ou o mais recente da
+    origem com --repair): arquivos ausentes, JSON inválido ou com num
+    diferente do nome do arquivo (o #404 não existe e é ignorado).
+    --repair baixa de novo os problemáticos; depois rode xkcd index.
+
+  xkcd migrate [--cache DIR] [--to pack|dir] [--keep] | [--compact]
+    Converte o cache de um arquivo N.json por quadrinho para um único
+    comics.pack (registros só anexados + tabela de offsets em
+    comics.pack.idx) ou de volta (--to dir). Com o pack, todos os comandos
+    leem e gravam nele; quadrinhos regravados deixam o registro antigo como
+    lixo, removido por --compact (ou pelo index, quando passa de 1/4 do
+    pack). A compactação grava um pack novo e o troca de uma vez. --keep
+    mantém os arquivos do formato antigo. O índice continua válido.
+
+  xkcd export --html DIR [--cache DIR] [--terms N]
+    Gera um site estático em DIR a partir do cache e do índice, sem rede:
+    uma página por quadrinho (comic/N.html), listas por ano (year/),
+    nuvem com os N (padrão 150) termos mais frequentes (termos.html) e
+    index.html com busca no navegador sobre search-data.js (termos do
+    índice já analisados). Imagens baixadas com index --images são
+    copiadas para DIR/images; as demais apontam para o xkcd.com.
 
 Exemplos:
   xkcd index --cache ~/.xkcd-cache
   xkcd search --cache ~/.xkcd-cache "quantum" "cat"
+  xkcd search --cache ~/.xkcd-cache 'physics OR chemistry -biology "black hole"'
 `)
 	os.Exit(1)
 }
@@ -77,65 +198,250 @@ func indexCmd(args []string) {
 	fs := flag.NewFlagSet("index", flag.ExitOnError)
 	cacheDir := fs.String("cache", filepath.Join(os.Getenv("HOME"), defaultCacheDirName), "diretório de cache")
 	workers := fs.Int("workers", runtime.NumCPU(), "número de workers para download")
-	rebuild := fs.Bool("rebuild", false, "forçar rebuild do índice (re-indexa arquivos em cache)")
+	rebuild := fs.Bool("rebuild", false, "forçar rebuild completo do índice (re-indexa todos os arquivos em cache)")
+	format := fs.String("format", "json", "formato do índice salvo: json ou bin")
+	stemmer := fs.String("stemmer", "english", "stemmer: english, portuguese ou none")
+	stopWords := fs.String("stopwords", "en", "stop words: listas embutidas (en, pt) e/ou arquivos, separados por vírgula; none desliga")
+	noFold := fs.Bool("no-fold", false, "manter acentos (não converter é -> e, ç -> c)")
+	images := fs.Bool("images", false, "baixar também as imagens dos quadrinhos para images/")
+	src := registerFetchFlags(fs)
+	recheck := fs.Bool("recheck", false, "ignorar o checkpoint e conferir todos os quadrinhos desde o 1")
+	retryFailed := fs.Bool("retry-failed", false, "baixar de novo só os quadrinhos listados em failed.json")
 	fs.Parse(args)
 
+	cfg := defaultAnalyzerConfig()
+	cfg.Stemmer, cfg.Fold = *stemmer, !*noFold
+	sw, err := parseStopWords(*stopWords, cfg.Fold)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro: %v\n", err)
+		os.Exit(1)
+	}
+	cfg.StopWords = sw
+	an, err := newAnalyzer(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro: %v\n", err)
+		os.Exit(1)
+	}
+
+	paths := indexPaths(*cacheDir)
+	idxPath, ok := paths[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "formato de índice desconhecido: %s (use json ou bin)\n", *format)
+		os.Exit(1)
+	}
+
 	if err := os.MkdirAll(*cacheDir, 0o755); err != nil {
 		fmt.Fprintf(os.Stderr, "erro criando cache dir: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Println("Obtendo número do quadrinho mais recente...")
-	latest, err := fetchLatestNum()
+	// Ctrl-C/SIGTERM: para de baixar, grava o checkpoint e sai
+	ctx, stop := signalContext()
+	defer stop()
+
+	if n, err := sweepTmpFiles(*cacheDir); err != nil {
+		fmt.Fprintf(os.Stderr, "warn: limpando temporários: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("Removidos %d arquivos .tmp de uma execução interrompida.\n", n)
+	}
+
+	cs, err := openWritableStore(*cacheDir)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "erro obtendo latest: %v\n", err)
+		fmt.Fprintf(os.Stderr, "erro abrindo o cache: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("último quadrinho: %d\n", latest)
+	// o pack grava a tabela de offsets ao fechar; interrompido, ela é refeita
+	// relendo o fim do pack na próxima abertura
+	closeStore := func() {
+		if err := cs.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "erro fechando %s: %v\n", cs, err)
+			os.Exit(1)
+		}
+	}
+
+	fetcher, retry := src.fetcher(), src.retry
+	opts := downloadOptions{Workers: *workers, Recheck: *recheck, RetryFailed: *retryFailed, Retry: retry}
+
+	var latest int
+	if !*retryFailed {
+		fmt.Println("Obtendo número do quadrinho mais recente...")
+		err = retry.do(ctx, func() (err error) {
+			latest, err = fetchLatestNum(ctx, fetcher)
+			return err
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "erro obtendo latest: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("último quadrinho: %d\n", latest)
+	}
 
 	// baixar todos JSONs com cache (pula se já existir)
 	fmt.Println("Baixando JSONs (se ainda não existirem)...")
-	if err := downloadAll(latest, *cacheDir, *workers); err != nil {
+	failures, err := downloadAll(ctx, fetcher, latest, *cacheDir, cs, opts)
+	if err != nil {
+		if ctx.Err() != nil {
+			closeStore()
+			interrupted()
+		}
 		fmt.Fprintf(os.Stderr, "erro download: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Println("Download concluído (cache).")
+	if len(failures) == 0 {
+		fmt.Println("Download concluído (cache).")
+	} else {
+		fmt.Printf("Download concluído com %d falhas; o índice será construído com o que está no cache.\n", len(failures))
+	}
 
-	// construir índice a partir dos JSONs no cache
-	idxPath := filepath.Join(*cacheDir, indexFilename)
+	if *images {
+		fmt.Println("Baixando imagens (se ainda não existirem)...")
+		n, failed, err := downloadImages(ctx, fetcher, *cacheDir, cs, opts)
+		if ctx.Err() != nil {
+			closeStore()
+			interrupted()
+		}
+		if err != nil && failed == 0 {
+			fmt.Fprintf(os.Stderr, "erro baixando imagens: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Imagens baixadas: %d, falhas: %d (em %s)\n", n, failed, imagesDir(*cacheDir))
+	}
+
+	// quadrinhos regravados deixam registros antigos no pack
+	if p, ok := cs.(*packStore); ok && p.needsCompaction() {
+		fmt.Println("Compactando o pack...")
+		freed, err := p.compact()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "erro compactando %s: %v\n", p, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Pack compactado (%d bytes liberados).\n", freed)
+	}
+
+	// construir/atualizar índice a partir dos JSONs no cache
+	metaPath := filepath.Join(*cacheDir, metaFilename)
+	var (
+		index *Index
+		meta  *indexMeta
+	)
 	if *rebuild {
 		fmt.Println("Rebuild forçado do índice.")
-		if err := os.Remove(idxPath); err != nil && !errors.Is(err, os.ErrNotExist) {
-			fmt.Fprintf(os.Stderr, "erro removendo índice antigo: %v\n", err)
-			os.Exit(1)
+		index, meta = newIndex(an), newIndexMeta()
+	} else {
+		index, meta, err = loadIndexForUpdate(findIndexPath(*cacheDir), metaPath, an)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintf(os.Stderr, "índice existente não aproveitado (%v); reconstruindo\n", err)
+			}
+		} else {
+			fmt.Printf("Atualizando índice existente (até o quadrinho %d)...\n", meta.MaxNum)
 		}
 	}
 
 	fmt.Println("Construindo índice...")
-	index, err := buildIndexFromCache(*cacheDir)
+	stats, err := updateIndexFromCache(cs, index, meta)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "erro construindo índice: %v\n", err)
 		os.Exit(1)
 	}
+	closeStore()
+	fmt.Printf("Arquivos %s\n", stats)
 	if err := saveIndex(idxPath, index); err != nil {
 		fmt.Fprintf(os.Stderr, "erro salvando índice: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("Índice salvo em %s (tokens: %d)\n", idxPath, len(index))
+	// remover índice no outro formato para não carregar uma versão desatualizada
+	for f, p := range paths {
+		if f != *format {
+			if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintf(os.Stderr, "warn: não foi possível remover %s: %v\n", p, err)
+			}
+		}
+	}
+	if err := saveIndexMeta(metaPath, meta); err != nil {
+		fmt.Fprintf(os.Stderr, "erro salvando metadados do índice: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Índice salvo em %s (quadrinhos: %d, tokens: %d)\n", idxPath, len(index.Docs), len(index.Terms))
+
+	if len(failures) > 0 {
+		printFailures(os.Stderr, failures, filepath.Join(*cacheDir, failedFilename))
+		os.Exit(1)
+	}
+}
+
+// printFailures resume as falhas de download (as primeiras, agrupadas por erro)
+func printFailures(w io.Writer, failures []downloadFailure, path string) {
+	const maxListed = 10
+	fmt.Fprintf(w, "\n%d quadrinhos não puderam ser baixados:\n", len(failures))
+	for i, f := range failures {
+		if i == maxListed {
+			fmt.Fprintf(w, "  ... e mais %d\n", len(failures)-maxListed)
+			break
+		}
+		fmt.Fprintf(w, "  #%d: %s\n", f.Num, f.Error)
+	}
+	fmt.Fprintf(w, "Detalhes em %s; rode `xkcd index --retry-failed` para tentar só esses de novo.\n", path)
 }
 
 func searchCmd(args []string) {
 	fs := flag.NewFlagSet("search", flag.ExitOnError)
 	cacheDir := fs.String("cache", filepath.Join(os.Getenv("HOME"), defaultCacheDirName), "diretório de cache")
+	fuzzy := fs.Int("fuzzy", 0, fmt.Sprintf("expandir cada termo para termos do índice a até N edições (0-%d)", maxFuzzy))
+	maxExp := fs.Int("max-expansions", defaultMaxExpansions, "máximo de termos gerados por cada curinga (quant*, *bit*)")
+	format := fs.String("format", "text", "formato da saída: "+strings.Join(outputFormats, ", "))
+	since := fs.String("since", "", "só quadrinhos publicados a partir de AAAA[-MM[-DD]]")
+	until := fs.String("until", "", "só quadrinhos publicados até AAAA[-MM[-DD]] (inclusive)")
+	snippetLen := fs.Int("snippet-len", defaultSnippetLen, "tamanho (em caracteres) do trecho mostrado em volta dos termos encontrados")
+	full := fs.Bool("full", false, "mostrar a transcrição/alt inteira em vez do trecho")
+	synFile := fs.String("synonyms", "", "arquivo de sinônimos (padrão: "+synonymsFilename+" no cache, se existir)")
+	noSyn := fs.Bool("no-synonyms", false, "não expandir sinônimos")
+	sortBy := fs.String("sort", "relevance", "ordem dos resultados: "+strings.Join(sortModes, ", "))
+	tmplText := fs.String("template", "", "text/template aplicado a cada resultado (ex.: '{{.Num}}\t{{.Title}}'); ignora --format")
 	fs.Parse(args)
 
+	if *fuzzy < 0 || *fuzzy > maxFuzzy {
+		fmt.Fprintf(os.Stderr, "--fuzzy deve estar entre 0 e %d\n", maxFuzzy)
+		os.Exit(1)
+	}
+	if !slices.Contains(outputFormats, *format) {
+		fmt.Fprintf(os.Stderr, "formato desconhecido: %s (use %s)\n", *format, strings.Join(outputFormats, ", "))
+		os.Exit(1)
+	}
+	opts := searchOptions{Fuzzy: *fuzzy, MaxExpansions: *maxExp, Sort: *sortBy}
+	if !slices.Contains(sortModes, opts.Sort) {
+		fmt.Fprintf(os.Stderr, "ordenação desconhecida: %s (use %s)\n", opts.Sort, strings.Join(sortModes, ", "))
+		os.Exit(1)
+	}
+	var err error
+	if opts.Since, err = parseDateBound(*since, false); err != nil {
+		fmt.Fprintf(os.Stderr, "--since: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.Until, err = parseDateBound(*until, true); err != nil {
+		fmt.Fprintf(os.Stderr, "--until: %v\n", err)
+		os.Exit(1)
+	}
+	if !*noSyn {
+		if opts.Synonyms, err = cacheSynonyms(*cacheDir, *synFile); err != nil {
+			fmt.Fprintf(os.Stderr, "sinônimos: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	var tmpl *template.Template
+	if *tmplText != "" {
+		if tmpl, err = parseHitTemplate(*tmplText); err != nil {
+			fmt.Fprintf(os.Stderr, "template inválido: %v\n", err)
+			os.Exit(1)
+		}
+	}
 	terms := fs.Args()
 	if len(terms) == 0 {
 		fmt.Fprintln(os.Stderr, "forneça pelo menos um termo de busca")
 		usageAndExit()
 	}
 
-	idxPath := filepath.Join(*cacheDir, indexFilename)
+	idxPath := findIndexPath(*cacheDir)
 	index, err := loadIndex(idxPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "erro carregando índice (%s): %v\n", idxPath, err)
@@ -143,304 +449,146 @@ func searchCmd(args []string) {
 		os.Exit(1)
 	}
 
-	// tokenizar termos de busca, buscar interseção
-	tokens := tokenize(strings.Join(terms, " "))
-	if len(tokens) == 0 {
-		fmt.Fprintln(os.Stderr, "nenhum token válido nos termos")
+	// avaliar a consulta (AND/OR/NOT, frases, parênteses) sobre o índice
+	query := strings.Join(terms, " ")
+	resp, err := index.search(query, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "consulta inválida: %v\n", err)
 		os.Exit(1)
 	}
-
-	// obter lista de quadrinhos que satisfazem todos tokens (AND)
-	var resultIDs []int
-	for i, tok := range tokens {
-		ids := index[tok]
-		if i == 0 {
-			resultIDs = append([]int{}, ids...)
-		} else {
-			resultIDs = intersect(resultIDs, ids)
+	for _, t := range sortedKeys(resp.Expanded) {
+		note := ""
+		if total, ok := resp.Truncated[t]; ok {
+			note = fmt.Sprintf(" (limitado a %d de %d termos)", len(resp.Expanded[t]), total)
 		}
-		if len(resultIDs) == 0 {
-			break
+		terms := strings.Join(resp.Expanded[t], ", ")
+		if terms == "" {
+			terms = "(nenhum termo)"
 		}
-	}
-	if len(resultIDs) == 0 {
-		fmt.Println("Nenhum resultado encontrado.")
-		return
-	}
-
-	// ordenar e imprimir cada quadrinho com URL + transcrição
-	sort.Ints(resultIDs)
-	for _, id := range resultIDs {
-		path := filepath.Join(*cacheDir, fmt.Sprintf("%d.json", id))
-		c, err := loadComicFromFile(path)
-		if err != nil {
-			// se não tiver no cache, apenas pular
-			fmt.Fprintf(os.Stderr, "erro lendo %s: %v\n", path, err)
-			continue
+		fmt.Fprintf(os.Stderr, "%s -> %s%s\n", t, terms, note)
+	}
+	text := tmpl == nil && *format == "text"
+	// destaque dos termos: ANSI no terminal, **negrito** em Markdown
+	snip := snippetOptions{Len: *snippetLen, Full: *full, HL: plainHL}
+	switch {
+	case text && isTerminal(os.Stdout):
+		snip.HL = ansiHL
+	case tmpl == nil && *format == "md":
+		snip.HL = mdHL
+	}
+	if len(resp.Results) == 0 {
+		// nas saídas para máquinas, sugestões vão para stderr
+		out := os.Stderr
+		if text {
+			out = os.Stdout
+			fmt.Println("Nenhum resultado encontrado.")
+		}
+		for _, t := range sortedKeys(resp.Suggestions) {
+			fmt.Fprintf(out, "Você quis dizer (%s): %s\n", t, strings.Join(resp.Suggestions[t], ", "))
+		}
+		if text {
+			return
 		}
-		printComicResult(c)
 	}
-}
 
-// fetchLatestNum pega o número do quadrinho mais recente via https://xkcd.com/info.0.json
-func fetchLatestNum() (int, error) {
-	const url = "https://xkcd.com/info.0.json"
-	client := &http.Client{Timeout: 15 * time.Second}
-	resp, err := client.Get(url)
+	imgs, err := loadImageManifest(*cacheDir)
 	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return 0, fmt.Errorf("status %d", resp.StatusCode)
-	}
-	var c XKCD
-	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
-		return 0, err
+		fmt.Fprintf(os.Stderr, "warn: manifesto de imagens: %v\n", err)
 	}
-	if c.Num == 0 {
-		return 0, errors.New("num zero no latest")
-	}
-	return c.Num, nil
-}
-
-// downloadAll baixa todos os JSONs de 1..latest se ainda não existirem no cache
-func downloadAll(latest int, cacheDir string, workers int) error {
-	type job struct{ n int }
-	jobs := make(chan job, workers*2)
-	wg := sync.WaitGroup{}
-	errCh := make(chan error, workers)
-
-	client := &http.Client{Timeout: 20 * time.Second}
-
-	// workers
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for j := range jobs {
-				path := filepath.Join(cacheDir, fmt.Sprintf("%d.json", j.n))
-				if _, err := os.Stat(path); err == nil {
-					// já existe
-					continue
-				}
-				if err := downloadComic(client, j.n, path); err != nil {
-					errCh <- fmt.Errorf("erro baixando %d: %w", j.n, err)
-					return
-				}
-				// pequeno sleep para não sobrecarregar
-				time.Sleep(100 * time.Millisecond)
-			}
-		}()
-	}
-
-	// enfileira
-	go func() {
-		for n := 1; n <= latest; n++ {
-			jobs <- job{n: n}
-		}
-		close(jobs)
-	}()
-
-	wg.Wait()
-	close(errCh)
-	// se houver erro, retornar primeiro
-	for e := range errCh {
-		return e
+	cs, err := openStore(*cacheDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro abrindo o cache: %v\n", err)
+		os.Exit(1)
 	}
-	return nil
-}
+	defer cs.Close()
 
-func downloadComic(client *http.Client, n int, path string) error {
-	url := fmt.Sprintf("https://xkcd.com/%d/info.0.json", n)
-	// Retry simples
-	var lastErr error
-	for attempt := 1; attempt <= 3; attempt++ {
-		resp, err := client.Get(url)
+	// resultados já vêm ordenados por relevância
+	hits := []searchHit{}
+	for _, r := range resp.Results {
+		c, err := loadComic(cs, r.Num)
 		if err != nil {
-			lastErr = err
-			time.Sleep(time.Duration(attempt) * 200 * time.Millisecond)
-			continue
-		}
-		if resp.StatusCode == http.StatusNotFound {
-			resp.Body.Close()
-			fmt.Printf("quadrinho %d não existe (404) — ignorando\n", n)
-			return nil
-		}
-		if resp.StatusCode != http.StatusOK {
-			lastErr = fmt.Errorf("status %d", resp.StatusCode)
-			resp.Body.Close()
-			time.Sleep(time.Duration(attempt) * 200 * time.Millisecond)
-			continue
-		}
-		// salvar em arquivo temporário e renomear (segurança)
-		tmp := path + ".tmp"
-		f, err := os.Create(tmp)
-		if err != nil {
-			resp.Body.Close()
-			return err
-		}
-		_, err = io.Copy(f, resp.Body)
-		resp.Body.Close()
-		f.Close()
-		if err != nil {
-			os.Remove(tmp)
-			lastErr = err
-			time.Sleep(time.Duration(attempt) * 200 * time.Millisecond)
+			// se não tiver no cache, apenas pular
+			fmt.Fprintf(os.Stderr, "erro lendo o quadrinho %d: %v\n", r.Num, err)
 			continue
 		}
-		if err := os.Rename(tmp, path); err != nil {
-			return err
+		h := newSearchHit(c, r, localImagePath(*cacheDir, imgs, c.Num))
+		h.snippetField, h.Snippet = index.comicSnippet(c, resp.Terms, snip)
+		hits = append(hits, h)
+	}
+
+	switch {
+	case tmpl != nil:
+		err = writeHitsTemplate(os.Stdout, tmpl, hits)
+	case text:
+		// imprimir cada quadrinho com URL + transcrição
+		for _, h := range hits {
+			printComicResult(os.Stdout, h.Comic, h.LocalImg, h.snippetField, h.Snippet)
 		}
-		return nil
-	}
-	return lastErr
-}
-
-// buildIndexFromCache varre os arquivos *.json no cache e constroi o índice invertido
-func buildIndexFromCache(cacheDir string) (Index, error) {
-	idx := make(Index)
-	err := filepath.WalkDir(cacheDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-		if !strings.HasSuffix(d.Name(), ".json") {
-			return nil
-		}
-		// pular o próprio arquivo index.json
-		if d.Name() == indexFilename {
-			return nil
-		}
-		c, err := loadComicFromFile(path)
-		if err != nil {
-			// ignore arquivos inválidos
-			fmt.Fprintf(os.Stderr, "warn: não foi possível ler %s: %v\n", path, err)
-			return nil
-		}
-		// obter tokens do conjunto de campos que queremos pesquisar
-		text := strings.Join([]string{c.Title, c.SafeTitle, c.Alt, c.Transcript}, " ")
-		toks := tokenize(text)
-		unique := map[string]struct{}{}
-		for _, t := range toks {
-			unique[t] = struct{}{}
-		}
-		for t := range unique {
-			idx[t] = append(idx[t], c.Num)
-		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-	// ordenar listas e remover duplicatas (segurança)
-	for k := range idx {
-		arr := uniqueInts(idx[k])
-		sort.Ints(arr)
-		idx[k] = arr
+	default:
+		err = writeHits(os.Stdout, *format, query, hits)
 	}
-	return idx, nil
-}
-
-func loadComicFromFile(path string) (*XKCD, error) {
-	b, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
-	}
-	var c XKCD
-	if err := json.Unmarshal(b, &c); err != nil {
-		return nil, err
+		fmt.Fprintf(os.Stderr, "erro escrevendo resultados: %v\n", err)
+		os.Exit(1)
 	}
-	return &c, nil
 }
 
-func saveIndex(path string, idx Index) error {
-	b, err := json.MarshalIndent(idx, "", "  ")
-	if err != nil {
-		return err
-	}
-	tmp := path + ".tmp"
-	if err := os.WriteFile(tmp, b, 0o644); err != nil {
-		return err
-	}
-	return os.Rename(tmp, path)
+// signalContext devolve um contexto cancelado no primeiro Ctrl-C/SIGTERM; a
+// partir daí um segundo sinal encerra o processo na hora
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
 }
 
-func loadIndex(path string) (Index, error) {
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-	var idx Index
-	if err := json.Unmarshal(b, &idx); err != nil {
-		return nil, err
-	}
-	return idx, nil
+// interrupted encerra após Ctrl-C/SIGTERM; o progresso já foi gravado
+func interrupted() {
+	fmt.Fprintln(os.Stderr, "\nInterrompido. Progresso salvo; rode `xkcd index` de novo para continuar.")
+	os.Exit(130)
 }
 
-// tokenize: separa palavras por qualquer rune que não seja letra ou dígito e normaliza pra minúsculas
-func tokenize(s string) []string {
-	f := func(r rune) bool {
-		// considera letras e dígitos como parte do token
-		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
-			return false
-		}
-		// tratar acentos: usar unicode.IsLetter seria mais completo, mas evita dependências aqui
-		return true
-	}
-	raw := strings.FieldsFunc(strings.ToLower(s), f)
-	// filtrar tokens vazios e curtos
-	out := make([]string, 0, len(raw))
-	for _, t := range raw {
-		t = strings.TrimSpace(t)
-		if t == "" || len(t) < 2 {
-			continue
-		}
-		out = append(out, t)
-	}
-	return out
+// comicPath: caminho do JSON do quadrinho n no cache
+func comicPath(cacheDir string, n int) string {
+	return filepath.Join(cacheDir, comicFileName(n))
 }
 
-func uniqueInts(a []int) []int {
-	m := map[int]struct{}{}
-	for _, v := range a {
-		m[v] = struct{}{}
-	}
-	out := make([]int, 0, len(m))
-	for k := range m {
-		out = append(out, k)
-	}
-	return out
+// comicURL: página do quadrinho no site
+func comicURL(n int) string {
+	return fmt.Sprintf("https://xkcd.com/%d/", n)
 }
 
-func intersect(a, b []int) []int {
-	set := map[int]struct{}{}
-	for _, v := range a {
-		set[v] = struct{}{}
+// localImagePath: caminho da imagem baixada do quadrinho, ou "" se não houver
+func localImagePath(cacheDir string, imgs *imageManifest, num int) string {
+	if rel := imgs.localImage(num); rel != "" {
+		return filepath.Join(cacheDir, rel)
 	}
-	var out []int
-	for _, v := range b {
-		if _, ok := set[v]; ok {
-			out = append(out, v)
-		}
-	}
-	return uniqueInts(out)
+	return ""
 }
 
-func printComicResult(c *XKCD) {
-	url := fmt.Sprintf("https://xkcd.com/%d/", c.Num)
-	fmt.Println("------------------------------------------------------------")
-	fmt.Printf("Num: %d\nTitle: %s\nURL: %s\nImage: %s\n", c.Num, c.Title, url, c.Img)
-	if strings.TrimSpace(c.Transcript) != "" {
-		fmt.Println("\n--- Transcript ---")
-		fmt.Println(strings.TrimSpace(c.Transcript))
-	} else if strings.TrimSpace(c.Alt) != "" {
-		fmt.Println("\n--- Alt / Hover text ---")
-		fmt.Println(strings.TrimSpace(c.Alt))
-	} else {
-		fmt.Println("\n(sem transcript nem alt)")
+// printComicResult imprime o quadrinho; localImg é o caminho da imagem no cache
+// ("" se não baixada) e field/body o campo e o texto mostrados (ver comicBody)
+func printComicResult(w io.Writer, c *XKCD, localImg, field, body string) {
+	url := comicURL(c.Num)
+	fmt.Fprintln(w, "------------------------------------------------------------")
+	fmt.Fprintf(w, "Num: %d\nTitle: %s\nURL: %s\nImage: %s\n", c.Num, c.Title, url, c.Img)
+	if d := comicDate(c); d != "" {
+		fmt.Fprintf(w, "Date: %s\n", d)
+	}
+	if localImg != "" {
+		fmt.Fprintf(w, "Local image: %s\n", localImg)
+	}
+	switch field {
+	case fieldTranscript:
+		fmt.Fprintln(w, "\n--- Transcript ---")
+		fmt.Fprintln(w, body)
+	case fieldAlt:
+		fmt.Fprintln(w, "\n--- Alt / Hover text ---")
+		fmt.Fprintln(w, body)
+	default:
+		fmt.Fprintln(w, "\n(sem transcript nem alt)")
 	}
-	fmt.Println()
+	fmt.Fprintln(w)
 }
@@ -0,0 +1,165 @@
+// meta.go
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+const metaFilename = "index.meta.json"
+
+// fileMeta: estado de um N.json do cache no momento em que foi indexado
+type fileMeta struct {
+	Num     int       `json:"num"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Hash    string    `json:"sha256"`
+}
+
+// indexMeta fica ao lado do índice e permite reindexar só o que mudou
+type indexMeta struct {
+	Version int                 `json:"version"`
+	MaxNum  int                 `json:"max_num"` // maior quadrinho indexado
+	Files   map[string]fileMeta `json:"files"`   // nome do arquivo -> estado
+}
+
+func newIndexMeta() *indexMeta {
+	return &indexMeta{Version: indexVersion, Files: make(map[string]fileMeta)}
+}
+
+// indexStats resume o que uma atualização incremental fez
+type indexStats struct {
+	Added, Updated, Removed, Unchanged int
+}
+
+func (s indexStats) String() string {
+	return fmt.Sprintf("novos: %d, alterados: %d, removidos: %d, sem mudança: %d",
+		s.Added, s.Updated, s.Removed, s.Unchanged)
+}
+
+// updateIndexFromCache compara os quadrinhos do store com os metadados e
+// aplica no índice só os novos, alterados (tamanho/mtime diferentes e hash
+// diferente) ou removidos. Com índice e metadados vazios equivale a um rebuild.
+func updateIndexFromCache(cs comicStore, idx *Index, meta *indexMeta) (indexStats, error) {
+	var st indexStats
+	seen := map[string]bool{}
+	var stale []int   // quadrinhos alterados ou removidos, a tirar do índice
+	var added []*XKCD // quadrinhos novos ou alterados, a (re)indexar
+	list, err := cs.List()
+	if err != nil {
+		return st, err
+	}
+	for _, sc := range list {
+		// os metadados continuam chaveados pelo nome N.json, em qualquer store
+		name := comicFileName(sc.Num)
+		old, known := meta.Files[name]
+		if known && old.Size == sc.Size && old.ModTime.Equal(sc.ModTime) {
+			seen[name] = true
+			st.Unchanged++
+			continue
+		}
+		b, err := cs.Get(sc.Num)
+		if err != nil {
+			return st, err
+		}
+		sum := sha256.Sum256(b)
+		hash := hex.EncodeToString(sum[:])
+		if known && old.Hash == hash {
+			// só o mtime mudou (ex.: arquivo copiado); conteúdo igual
+			old.Size, old.ModTime = sc.Size, sc.ModTime
+			meta.Files[name] = old
+			seen[name] = true
+			st.Unchanged++
+			continue
+		}
+		c := &XKCD{}
+		if err := json.Unmarshal(b, c); err != nil {
+			// ignore arquivos inválidos
+			fmt.Fprintf(os.Stderr, "warn: não foi possível ler o quadrinho %d: %v\n", sc.Num, err)
+			continue
+		}
+		seen[name] = true
+		if known {
+			stale = append(stale, old.Num)
+			st.Updated++
+		} else {
+			st.Added++
+		}
+		added = append(added, c)
+		meta.Files[name] = fileMeta{Num: c.Num, Size: sc.Size, ModTime: sc.ModTime, Hash: hash}
+	}
+	for name, fm := range meta.Files {
+		if !seen[name] {
+			stale = append(stale, fm.Num)
+			delete(meta.Files, name)
+			st.Removed++
+		}
+	}
+	// removeDoc faz busca binária nas postings, que só ficam ordenadas até o
+	// primeiro addComic: todas as remoções vêm antes das inclusões
+	for _, n := range stale {
+		idx.removeDoc(n)
+	}
+	for _, c := range added {
+		idx.addComic(c)
+	}
+	meta.MaxNum = 0
+	for _, fm := range meta.Files {
+		meta.MaxNum = max(meta.MaxNum, fm.Num)
+	}
+	idx.finish()
+	return st, nil
+}
+
+func saveIndexMeta(path string, meta *indexMeta) error {
+	b, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func loadIndexMeta(path string) (*indexMeta, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var meta indexMeta
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return nil, err
+	}
+	if meta.Version != indexVersion || meta.Files == nil {
+		return nil, fmt.Errorf("metadados de versão %d (esperado %d)", meta.Version, indexVersion)
+	}
+	return &meta, nil
+}
+
+// loadIndexForUpdate carrega índice e metadados existentes para atualização
+// incremental; se algum faltar, for incompatível ou tiver sido gerado com outro
+// analisador, devolve ambos vazios (rebuild completo) e o motivo.
+func loadIndexForUpdate(idxPath, metaPath string, an *Analyzer) (*Index, *indexMeta, error) {
+	idx, err := loadIndex(idxPath)
+	if err != nil {
+		return newIndex(an), newIndexMeta(), err
+	}
+	if !idx.Analyzer.equal(an.cfg) {
+		return newIndex(an), newIndexMeta(), fmt.Errorf("analisador do índice (%s) difere do pedido (%s)", idx.Analyzer, an.cfg)
+	}
+	meta, err := loadIndexMeta(metaPath)
+	if err != nil {
+		return newIndex(an), newIndexMeta(), err
+	}
+	// metadados que não batem com o índice (ex.: índice copiado de outro lugar)
+	if len(meta.Files) != len(idx.Docs) {
+		return newIndex(an), newIndexMeta(), fmt.Errorf("metadados (%d arquivos) não batem com o índice (%d quadrinhos)", len(meta.Files), len(idx.Docs))
+	}
+	return idx, meta, nil
+}
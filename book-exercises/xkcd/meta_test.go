@@ -0,0 +1,97 @@
+// meta_test.go
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func testAnalyzer(t *testing.T) *Analyzer {
+	t.Helper()
+	an, err := newAnalyzer(defaultAnalyzerConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return an
+}
+
+func putComic(t *testing.T, cs comicStore, c XKCD) {
+	t.Helper()
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Put(c.Num, b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Quadrinhos novos com número menor e um alterado na mesma execução: a
+// posting antiga do alterado precisa sair antes das novas entrarem.
+func TestUpdateIndexRemovesBeforeAdding(t *testing.T) {
+	cs := &dirStore{dir: t.TempDir()}
+	putComic(t, cs, XKCD{Num: 20, Title: "foo", Year: "2010"})
+	putComic(t, cs, XKCD{Num: 30, Title: "foo bar", Year: "2010"})
+	idx, meta, err := buildIndexFromCache(cs, testAnalyzer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 1; n <= 4; n++ {
+		putComic(t, cs, XKCD{Num: n, Title: "foo", Year: "2006"})
+	}
+	putComic(t, cs, XKCD{Num: 30, Title: "foo bar baz quux", Year: "2010"})
+	st, err := updateIndexFromCache(cs, idx, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Added != 4 || st.Updated != 1 || st.Unchanged != 1 {
+		t.Fatalf("stats = %v", st)
+	}
+
+	got := idx.postingNums("foo")
+	want := []int{1, 2, 3, 4, 20, 30}
+	if len(got) != len(want) {
+		t.Fatalf("postings de foo = %v, esperado %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("postings de foo = %v, esperado %v", got, want)
+		}
+	}
+
+	resp, err := idx.search("foo", searchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("%d resultados, esperado %d", len(resp.Results), len(want))
+	}
+	for _, r := range resp.Results {
+		if r.Score < 0 {
+			t.Errorf("#%d com score negativo %v", r.Num, r.Score)
+		}
+	}
+
+	// remoção do cache também depois de inclusões fora de ordem
+	if err := removeFile(cs, 20); err != nil {
+		t.Fatal(err)
+	}
+	putComic(t, cs, XKCD{Num: 5, Title: "foo", Year: "2006"})
+	if _, err := updateIndexFromCache(cs, idx, meta); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range idx.postingNums("foo") {
+		if n == 20 {
+			t.Fatalf("#20 removido continua nas postings: %v", idx.postingNums("foo"))
+		}
+	}
+	if len(idx.postingNums("foo")) != len(idx.Docs) {
+		t.Fatalf("postings %v para %d documentos", idx.postingNums("foo"), len(idx.Docs))
+	}
+}
+
+func removeFile(cs *dirStore, n int) error {
+	return os.Remove(comicPath(cs.dir, n))
+}
@@ -0,0 +1,133 @@
+// migrate.go
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// migrateCmd converte o cache entre os stores de diretório (N.json) e pack.
+// Tamanho e data de cada quadrinho são preservados, então o índice existente
+// continua valendo e o próximo `xkcd index` não reindexa nada.
+func migrateCmd(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	cacheDir := fs.String("cache", filepath.Join(os.Getenv("HOME"), defaultCacheDirName), "diretório de cache")
+	to := fs.String("to", "pack", "formato de destino: pack ou dir")
+	compact := fs.Bool("compact", false, "só compactar o pack existente (descartar registros substituídos)")
+	keep := fs.Bool("keep", false, "manter os arquivos do formato antigo")
+	fs.Parse(args)
+
+	cs, err := openWritableStore(*cacheDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+		os.Exit(1)
+	}
+	p, isPack := cs.(*packStore)
+
+	switch {
+	case *compact:
+		if !isPack {
+			fmt.Fprintf(os.Stderr, "migrate: %s não usa pack; rode `xkcd migrate --to pack` antes\n", *cacheDir)
+			os.Exit(1)
+		}
+		freed, err := p.compact()
+		if err == nil {
+			err = p.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: compactando %s: %v\n", p, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Pack compactado (%d bytes liberados).\n", freed)
+	case *to == "pack":
+		if isPack {
+			fmt.Printf("O cache já usa %s.\n", p)
+			return
+		}
+		if err := migrateToPack(*cacheDir, cs.(*dirStore), *keep); err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+			os.Exit(1)
+		}
+	case *to == "dir":
+		if !isPack {
+			fmt.Printf("O cache %s já usa um arquivo por quadrinho.\n", *cacheDir)
+			return
+		}
+		if err := migrateToDir(*cacheDir, p, *keep); err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "formato desconhecido: %s (use pack ou dir)\n", *to)
+		os.Exit(1)
+	}
+}
+
+// migrateToPack grava os N.json num pack novo e, se não keep, apaga os
+// arquivos; o pack só passa a valer depois de completo (ver writePack)
+func migrateToPack(cacheDir string, d *dirStore, keep bool) error {
+	list, err := d.List()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Gravando %d quadrinhos em %s...\n", len(list), filepath.Join(cacheDir, packFilename))
+	if err := writePack(cacheDir, d); err != nil {
+		return fmt.Errorf("gravando o pack: %w", err)
+	}
+	p, err := openPackStore(cacheDir)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+	if got, _ := p.List(); len(got) != len(list) {
+		return fmt.Errorf("pack com %d quadrinhos, esperado %d; arquivos N.json mantidos", len(got), len(list))
+	}
+	if keep {
+		fmt.Println("Migração concluída (arquivos N.json mantidos; o pack tem prioridade).")
+		return nil
+	}
+	for _, sc := range list {
+		if err := os.Remove(comicPath(cacheDir, sc.Num)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	fmt.Printf("Migração concluída; %d arquivos N.json removidos.\n", len(list))
+	return nil
+}
+
+// migrateToDir grava cada quadrinho do pack como N.json e, se não keep,
+// remove o pack; interrompida, o pack continua valendo e basta rodar de novo
+func migrateToDir(cacheDir string, p *packStore, keep bool) error {
+	list, err := p.List()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Gravando %d quadrinhos como arquivos N.json em %s...\n", len(list), cacheDir)
+	d := &dirStore{dir: cacheDir}
+	for _, sc := range list {
+		b, err := p.Get(sc.Num)
+		if err == nil {
+			err = d.putAt(sc.Num, b, sc.ModTime)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := p.Close(); err != nil {
+		return err
+	}
+	if keep {
+		fmt.Printf("Migração concluída; remova %s para usar os arquivos N.json.\n", p)
+		return nil
+	}
+	for _, name := range []string{packFilename, packIndexFilename} {
+		if err := os.Remove(filepath.Join(cacheDir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	fmt.Println("Migração concluída; pack removido.")
+	return nil
+}
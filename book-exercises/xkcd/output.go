@@ -0,0 +1,132 @@
+// output.go
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// formatos aceitos por search --format
+var outputFormats = []string{"text", "json", "ndjson", "csv", "md"}
+
+// searchHit: um resultado de search no esquema estável das saídas json,
+// ndjson, csv e md. Comic fica de fora do JSON; serve a --template.
+type searchHit struct {
+	Num      int      `json:"num"`
+	Title    string   `json:"title"`
+	Date     string   `json:"date"` // AAAA-MM-DD ou "" se desconhecida
+	URL      string   `json:"url"`
+	Img      string   `json:"img"`
+	LocalImg string   `json:"local_img,omitempty"`
+	Score    float64  `json:"score"`
+	Fields   []string `json:"matched_fields"`
+	Snippet  string   `json:"snippet"` // trecho da transcrição/alt em volta dos termos
+	Comic    *XKCD    `json:"-"`
+
+	snippetField string // campo de onde saiu Snippet
+}
+
+func newSearchHit(c *XKCD, r searchResult, localImg string) searchHit {
+	fields := r.Fields
+	if fields == nil {
+		fields = []string{}
+	}
+	return searchHit{
+		Num:      c.Num,
+		Title:    c.Title,
+		Date:     comicDate(c),
+		URL:      comicURL(c.Num),
+		Img:      c.Img,
+		LocalImg: localImg,
+		Score:    r.Score,
+		Fields:   fields,
+		Comic:    c,
+	}
+}
+
+// searchOutput: documento de --format json
+type searchOutput struct {
+	Query   string      `json:"query"`
+	Total   int         `json:"total"`
+	Results []searchHit `json:"results"`
+}
+
+// writeHits escreve os resultados no formato pedido (exceto text, que usa
+// printComicResult)
+func writeHits(w io.Writer, format, query string, hits []searchHit) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(searchOutput{Query: query, Total: len(hits), Results: hits})
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, h := range hits {
+			if err := enc.Encode(h); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"num", "title", "date", "url", "img", "score", "matched_fields", "snippet"})
+		for _, h := range hits {
+			cw.Write([]string{
+				strconv.Itoa(h.Num), h.Title, h.Date, h.URL, h.Img,
+				strconv.FormatFloat(h.Score, 'f', 4, 64),
+				strings.Join(h.Fields, ";"),
+				h.Snippet,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "md":
+		if len(hits) == 0 {
+			_, err := fmt.Fprintln(w, "_Nenhum resultado._")
+			return err
+		}
+		fmt.Fprintln(w, "| # | Título | Data | Score | Campos | Trecho |")
+		fmt.Fprintln(w, "|---:|---|---|---:|---|---|")
+		for _, h := range hits {
+			fmt.Fprintf(w, "| %d | [%s](%s) | %s | %.2f | %s | %s |\n",
+				h.Num, mdEscape(h.Title), h.URL, h.Date, h.Score, strings.Join(h.Fields, ", "), mdEscape(h.Snippet))
+		}
+		return nil
+	}
+	return fmt.Errorf("formato desconhecido: %s", format)
+}
+
+// mdEscape protege o texto para uma célula de tabela Markdown
+func mdEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "[", `\[`, "]", `\]`, "\n", " ").Replace(s)
+}
+
+// parseHitTemplate compila o --template de search: aplicado a cada resultado
+// (um searchHit), com uma quebra de linha após cada um
+func parseHitTemplate(text string) (*template.Template, error) {
+	return template.New("hit").Funcs(template.FuncMap{
+		"join": strings.Join,
+	}).Parse(text)
+}
+
+func writeHitsTemplate(w io.Writer, t *template.Template, hits []searchHit) error {
+	for _, h := range hits {
+		var sb strings.Builder
+		if err := t.Execute(&sb, h); err != nil {
+			return err
+		}
+		s := sb.String()
+		if !strings.HasSuffix(s, "\n") {
+			s += "\n"
+		}
+		if _, err := io.WriteString(w, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
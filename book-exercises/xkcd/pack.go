@@ -0,0 +1,412 @@
+// pack.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Formato do store compactado:
+//
+//	comics.pack:     magic "XKCDPACK" | versão (uint16) | id (uint64) | registros...
+//	registro:        número (uint32) | tamanho (uint32) | mtime em ns (int64) |
+//	                 crc32 do JSON (uint32) | JSON
+//	comics.pack.idx: magic "XKCDPIDX" | versão (uint16) | id do pack (uint64) |
+//	                 bytes cobertos (uint64) | bytes de lixo (uint64) |
+//	                 quantidade (uint32) | entradas | crc32 do resto (uint32)
+//	entrada:         número (uint32) | offset (uint64) | tamanho (uint32) | mtime (int64)
+//
+// Inteiros em little endian. O pack só cresce: regravar um quadrinho anexa um
+// registro novo e o antigo vira lixo até a compactação, que reescreve o pack
+// inteiro num .tmp e renomeia. A tabela de offsets é gravada ao fechar; se
+// estiver atrasada (execução interrompida) ou for de outro pack, os registros
+// que ela não cobre são relidos do próprio pack.
+const (
+	packFilename      = "comics.pack"
+	packIndexFilename = "comics.pack.idx"
+	packMagic         = "XKCDPACK"
+	packIndexMagic    = "XKCDPIDX"
+	packVersion       = 1
+	packHeaderSize    = len(packMagic) + 2 + 8
+	packRecordHeader  = 4 + 4 + 8 + 4
+	packEntrySize     = 4 + 8 + 4 + 8
+)
+
+// packEntry: onde está o registro vigente de um quadrinho
+type packEntry struct {
+	off     int64 // início do JSON (depois do cabeçalho do registro)
+	size    int64
+	modTime time.Time
+}
+
+// packStore: os quadrinhos num único arquivo, com a tabela de offsets em memória
+type packStore struct {
+	dir string
+	id  uint64
+
+	mu      sync.RWMutex
+	f       *os.File // leitura
+	w       *os.File // escrita, aberto no primeiro Put
+	entries map[int]packEntry
+	end     int64 // fim do último registro válido
+	garbage int64 // bytes de registros substituídos
+	dirty   bool  // tabela em memória difere de comics.pack.idx
+	torn    bool  // há um registro incompleto depois de end (ver dropTornTail)
+}
+
+func openPackStore(dir string) (*packStore, error) {
+	path := filepath.Join(dir, packFilename)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &packStore{dir: dir, f: f, entries: map[int]packEntry{}}
+	if err := p.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// load lê o cabeçalho, a tabela de offsets e os registros que ela não cobre
+func (p *packStore) load() error {
+	info, err := p.f.Stat()
+	if err != nil {
+		return err
+	}
+	h := make([]byte, packHeaderSize)
+	if _, err := p.f.ReadAt(h, 0); err != nil || !bytes.HasPrefix(h, []byte(packMagic)) {
+		return errors.New("não é um pack de quadrinhos")
+	}
+	if v := binary.LittleEndian.Uint16(h[len(packMagic):]); v != packVersion {
+		return fmt.Errorf("versão do pack %d não suportada", v)
+	}
+	p.id = binary.LittleEndian.Uint64(h[len(packMagic)+2:])
+
+	p.end = int64(packHeaderSize)
+	if err := p.loadTable(info.Size()); err != nil {
+		p.entries, p.end, p.garbage = map[int]packEntry{}, int64(packHeaderSize), 0
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "warn: tabela do pack ignorada (%v); relendo o pack\n", err)
+		}
+	}
+	if p.end < info.Size() {
+		p.dirty = true
+		return p.scan(info.Size())
+	}
+	return nil
+}
+
+func (p *packStore) loadTable(packSize int64) error {
+	b, err := os.ReadFile(filepath.Join(p.dir, packIndexFilename))
+	if err != nil {
+		return err
+	}
+	fixed := len(packIndexMagic) + 2 + 8 + 8 + 8 + 4
+	if len(b) < fixed+4 || !bytes.HasPrefix(b, []byte(packIndexMagic)) {
+		return errors.New("tabela inválida")
+	}
+	body, sum := b[:len(b)-4], binary.LittleEndian.Uint32(b[len(b)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return errors.New("checksum da tabela não confere")
+	}
+	le := binary.LittleEndian
+	h := body[len(packIndexMagic):]
+	if v := le.Uint16(h); v != packVersion {
+		return fmt.Errorf("versão da tabela %d não suportada", v)
+	}
+	if le.Uint64(h[2:]) != p.id {
+		return errors.New("tabela de outro pack")
+	}
+	covered, garbage := int64(le.Uint64(h[10:])), int64(le.Uint64(h[18:]))
+	count := int(le.Uint32(h[26:]))
+	if covered > packSize || len(body) != fixed+count*packEntrySize {
+		return errors.New("tabela não bate com o pack")
+	}
+	for e := body[fixed:]; len(e) > 0; e = e[packEntrySize:] {
+		p.entries[int(le.Uint32(e))] = packEntry{
+			off:     int64(le.Uint64(e[4:])),
+			size:    int64(le.Uint32(e[12:])),
+			modTime: time.Unix(0, int64(le.Uint64(e[16:]))),
+		}
+	}
+	p.end, p.garbage = covered, garbage
+	return nil
+}
+
+// scan lê os registros de p.end até size; para no primeiro registro truncado
+// ou corrompido (escrita interrompida), que é cortado por quem abre o pack
+// para escrita (dropTornTail) ou sobrescrito no próximo Put
+func (p *packStore) scan(size int64) error {
+	r := bufio.NewReader(io.NewSectionReader(p.f, p.end, size-p.end))
+	h := make([]byte, packRecordHeader)
+	for {
+		if _, err := io.ReadFull(r, h); err != nil {
+			return nil
+		}
+		n := int(binary.LittleEndian.Uint32(h))
+		sz := int64(binary.LittleEndian.Uint32(h[4:]))
+		mod := time.Unix(0, int64(binary.LittleEndian.Uint64(h[8:])))
+		data := make([]byte, min(sz, size))
+		if _, err := io.ReadFull(r, data); err != nil || int64(len(data)) != sz ||
+			crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(h[16:]) {
+			fmt.Fprintf(os.Stderr, "warn: registro incompleto no fim do pack (offset %d) descartado\n", p.end)
+			p.torn = true
+			return nil
+		}
+		p.replace(n, packEntry{off: p.end + packRecordHeader, size: sz, modTime: mod})
+		p.end += packRecordHeader + sz
+	}
+}
+
+// replace aponta n para o registro novo, contando o antigo como lixo
+func (p *packStore) replace(n int, e packEntry) {
+	if old, ok := p.entries[n]; ok {
+		p.garbage += packRecordHeader + old.size
+	}
+	p.entries[n] = e
+}
+
+func (p *packStore) Has(n int) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	_, ok := p.entries[n]
+	return ok
+}
+
+func (p *packStore) Get(n int) ([]byte, error) {
+	p.mu.RLock()
+	e, ok := p.entries[n]
+	p.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("quadrinho %d: %w", n, os.ErrNotExist)
+	}
+	b := make([]byte, packRecordHeader+e.size)
+	if _, err := p.f.ReadAt(b, e.off-packRecordHeader); err != nil {
+		return nil, fmt.Errorf("quadrinho %d: %w", n, err)
+	}
+	if int(binary.LittleEndian.Uint32(b)) != n || crc32.ChecksumIEEE(b[packRecordHeader:]) != binary.LittleEndian.Uint32(b[16:]) {
+		return nil, fmt.Errorf("quadrinho %d: registro corrompido no pack", n)
+	}
+	return b[packRecordHeader:], nil
+}
+
+func (p *packStore) Put(n int, b []byte) error {
+	return p.putAt(n, b, time.Now())
+}
+
+// putAt anexa um registro ao pack; o anterior do mesmo quadrinho vira lixo
+func (p *packStore) putAt(n int, b []byte, mod time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.openWriter(); err != nil {
+		return err
+	}
+	rec := make([]byte, packRecordHeader, packRecordHeader+len(b))
+	binary.LittleEndian.PutUint32(rec, uint32(n))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(len(b)))
+	binary.LittleEndian.PutUint64(rec[8:], uint64(mod.UnixNano()))
+	binary.LittleEndian.PutUint32(rec[16:], crc32.ChecksumIEEE(b))
+	rec = append(rec, b...)
+	if _, err := p.w.WriteAt(rec, p.end); err != nil {
+		return err
+	}
+	p.replace(n, packEntry{off: p.end + packRecordHeader, size: int64(len(b)), modTime: mod})
+	p.end += int64(len(rec))
+	p.dirty = true
+	return nil
+}
+
+// openWriter abre o pack para escrita (uma vez), descartando um registro
+// incompleto deixado no fim; chamar com p.mu travado
+func (p *packStore) openWriter() error {
+	if p.w != nil {
+		return nil
+	}
+	w, err := os.OpenFile(filepath.Join(p.dir, packFilename), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if err := w.Truncate(p.end); err != nil {
+		w.Close()
+		return err
+	}
+	p.w, p.torn = w, false
+	return nil
+}
+
+// dropTornTail corta do arquivo o registro incompleto achado por scan, para
+// o aviso não se repetir a cada abertura. Só quem grava no cache chama (ver
+// openWritableStore): o fim incompleto pode ser uma escrita em andamento.
+func (p *packStore) dropTornTail() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.torn {
+		return nil
+	}
+	return p.openWriter()
+}
+
+func (p *packStore) List() ([]storedComic, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	out := make([]storedComic, 0, len(p.entries))
+	for n, e := range p.entries {
+		out = append(out, storedComic{Num: n, Size: e.size, ModTime: e.modTime})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Num < out[j].Num })
+	return out, nil
+}
+
+// Close grava a tabela de offsets se algo mudou
+func (p *packStore) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var err error
+	if p.w != nil {
+		err = p.w.Sync()
+		if cerr := p.w.Close(); err == nil {
+			err = cerr
+		}
+		p.w = nil
+	}
+	if err == nil && p.dirty {
+		err = p.saveTable()
+	}
+	if cerr := p.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (p *packStore) String() string { return filepath.Join(p.dir, packFilename) }
+
+func (p *packStore) saveTable() error {
+	nums := sortedKeys(p.entries)
+	b := make([]byte, 0, len(packIndexMagic)+30+len(nums)*packEntrySize+4)
+	le := binary.LittleEndian
+	b = append(b, packIndexMagic...)
+	b = le.AppendUint16(b, packVersion)
+	b = le.AppendUint64(b, p.id)
+	b = le.AppendUint64(b, uint64(p.end))
+	b = le.AppendUint64(b, uint64(p.garbage))
+	b = le.AppendUint32(b, uint32(len(nums)))
+	for _, n := range nums {
+		e := p.entries[n]
+		b = le.AppendUint32(b, uint32(n))
+		b = le.AppendUint64(b, uint64(e.off))
+		b = le.AppendUint32(b, uint32(e.size))
+		b = le.AppendUint64(b, uint64(e.modTime.UnixNano()))
+	}
+	b = le.AppendUint32(b, crc32.ChecksumIEEE(b))
+
+	path := filepath.Join(p.dir, packIndexFilename)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	p.dirty = false
+	return nil
+}
+
+// needsCompaction: mais de um quarto do pack é lixo
+func (p *packStore) needsCompaction() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.garbage > 0 && p.garbage*4 > p.end
+}
+
+// compact reescreve o pack só com os registros vigentes e o reabre; devolve
+// quantos bytes foram liberados
+func (p *packStore) compact() (int64, error) {
+	before := p.size()
+	if err := writePack(p.dir, p); err != nil {
+		return 0, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// a tabela antiga não é gravada: writePack já gravou a do pack novo
+	if p.w != nil {
+		p.w.Close()
+		p.w = nil
+	}
+	p.f.Close()
+	f, err := os.Open(filepath.Join(p.dir, packFilename))
+	if err != nil {
+		return 0, err
+	}
+	p.f, p.entries, p.garbage, p.dirty = f, map[int]packEntry{}, 0, false
+	if err := p.load(); err != nil {
+		return 0, err
+	}
+	return before - p.end, nil
+}
+
+func (p *packStore) size() int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.end
+}
+
+// writePack grava todos os quadrinhos de src num pack novo em dir, com a
+// tabela de offsets, e só então o coloca no lugar de comics.pack (o id novo
+// invalida qualquer tabela antiga que sobrar se a troca for interrompida)
+func writePack(dir string, src comicStore) error {
+	list, err := src.List()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, packFilename)
+	tmp := path + ".tmp"
+	w, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	np := &packStore{dir: dir, w: w, entries: map[int]packEntry{}, end: int64(packHeaderSize)}
+	np.id = uint64(time.Now().UnixNano())
+	h := make([]byte, 0, packHeaderSize)
+	h = append(h, packMagic...)
+	h = binary.LittleEndian.AppendUint16(h, packVersion)
+	h = binary.LittleEndian.AppendUint64(h, np.id)
+	if _, err := w.Write(h); err != nil {
+		w.Close()
+		return err
+	}
+	for _, sc := range list {
+		b, err := src.Get(sc.Num)
+		if err == nil {
+			err = np.putAt(sc.Num, b, sc.ModTime)
+		}
+		if err != nil {
+			np.w.Close()
+			return err
+		}
+	}
+	err = np.w.Sync()
+	if cerr := np.w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	// a tabela vai primeiro: até o rename do pack ela é de outro id e é ignorada
+	if err := np.saveTable(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,73 @@
+// pack_test.go
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPackTornTail(t *testing.T) {
+	dir := t.TempDir()
+	src := &dirStore{dir: t.TempDir()}
+	putComic(t, src, XKCD{Num: 1, Title: "Barrel"})
+	putComic(t, src, XKCD{Num: 2, Title: "Petit Trees"})
+	if err := writePack(dir, src); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, packFilename)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cabeçalho de um registro de 255 bytes com só 3 gravados
+	rec := make([]byte, packRecordHeader, packRecordHeader+3)
+	binary.LittleEndian.PutUint32(rec, 3)
+	binary.LittleEndian.PutUint32(rec[4:], 255)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(append(rec, "abc"...))
+	f.Close()
+
+	// só leitura: o fim continua no arquivo
+	p, err := openPackStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.torn || len(p.entries) != 2 {
+		t.Fatalf("torn = %v, %d quadrinhos", p.torn, len(p.entries))
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = openPackStore(dir); err != nil || !p.torn {
+		t.Fatalf("reaberto: torn = %v, erro %v", p != nil && p.torn, err)
+	}
+	p.Close()
+
+	cs, err := openWritableStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.Stat(path); got.Size() != info.Size() {
+		t.Fatalf("pack com %d bytes, esperado %d", got.Size(), info.Size())
+	}
+	p, err = openPackStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if p.torn || len(p.entries) != 2 {
+		t.Fatalf("depois de openWritableStore: torn = %v, %d quadrinhos", p.torn, len(p.entries))
+	}
+	if c, err := loadComic(p, 2); err != nil || c.Title != "Petit Trees" {
+		t.Fatalf("quadrinho 2: %v %v", c, err)
+	}
+}
@@ -0,0 +1,715 @@
+// query.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultNearDist: distância usada por NEAR sem /n
+const defaultNearDist = 5
+
+// Linguagem de consulta:
+//
+//	termo termo         AND implícito
+//	a AND b             AND explícito
+//	a OR b              OR (precedência menor que AND)
+//	-termo / NOT termo  exclusão
+//	"frase exata"       frase (termos em posições consecutivas do mesmo campo)
+//	a NEAR/n b          a e b no mesmo campo, separados por no máximo n posições
+//	                    (NEAR sozinho usa n = defaultNearDist)
+//	quant* / *bit*      curingas (* = qualquer sequência, ? = uma letra),
+//	                    comparados com as palavras dos quadrinhos (sem stemming)
+//	( ... )             agrupamento
+//	title:x alt:x       restringe termo, frase, curinga ou grupo a um campo
+//	transcript:x year:x (title: cobre title e safe_title); sem prefixo,
+//	                    busca em todos os campos de texto
+//
+// Precedência: NEAR > NOT > AND > OR. Os operandos de NEAR precisam ser termos,
+// frases ou outro NEAR.
+
+// errNoTokens: a consulta é válida, mas nenhuma palavra gerou token indexável
+var errNoTokens = errors.New("nenhum token válido nos termos")
+
+// queryError: erro de sintaxe com a posição (em bytes) na consulta
+type queryError struct {
+	Pos int
+	Msg string
+}
+
+func (e *queryError) Error() string {
+	return fmt.Sprintf("erro de sintaxe na posição %d: %s", e.Pos+1, e.Msg)
+}
+
+type qtokKind int
+
+const (
+	qtWord qtokKind = iota
+	qtPhrase
+	qtAnd
+	qtOr
+	qtNot
+	qtNear
+	qtLParen
+	qtRParen
+	qtEOF
+)
+
+type qtok struct {
+	kind qtokKind
+	text string
+	pos  int
+	dist int // só para qtNear
+}
+
+// lexQuery quebra a consulta em tokens (palavras, frases, operadores e parênteses)
+func lexQuery(s string) ([]qtok, error) {
+	var out []qtok
+	i := 0
+	for i < len(s) {
+		r := rune(s[i])
+		switch {
+		case strings.ContainsRune(" \t\n\r", r):
+			i++
+		case r == '(':
+			out = append(out, qtok{kind: qtLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			out = append(out, qtok{kind: qtRParen, text: ")", pos: i})
+			i++
+		case r == '-':
+			out = append(out, qtok{kind: qtNot, text: "-", pos: i})
+			i++
+		case r == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, &queryError{Pos: i, Msg: "aspas sem fechamento"}
+			}
+			out = append(out, qtok{kind: qtPhrase, text: s[i+1 : i+1+end], pos: i})
+			i += end + 2
+		default:
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t\n\r()\"", rune(s[i])) {
+				i++
+			}
+			w := s[start:i]
+			t := qtok{kind: qtWord, text: w, pos: start}
+			switch w {
+			case "AND":
+				t.kind = qtAnd
+			case "OR":
+				t.kind = qtOr
+			case "NOT":
+				t.kind = qtNot
+			case "NEAR":
+				t.kind, t.dist = qtNear, defaultNearDist
+			default:
+				if rest, ok := strings.CutPrefix(w, "NEAR/"); ok {
+					d, err := strconv.Atoi(rest)
+					if err != nil || d < 1 {
+						return nil, &queryError{Pos: start, Msg: fmt.Sprintf("distância inválida em %q (use NEAR/n com n >= 1)", w)}
+					}
+					t.kind, t.dist = qtNear, d
+				}
+			}
+			out = append(out, t)
+		}
+	}
+	out = append(out, qtok{kind: qtEOF, pos: len(s)})
+	return out, nil
+}
+
+// queryNode: nó da árvore de avaliação. eval devolve os números dos
+// quadrinhos que casam, em ordem crescente.
+type queryNode interface {
+	eval(idx *Index) []int
+	// positiveTerms acumula os termos que contam para o ranking (fora de NOT)
+	positiveTerms(acc []queryTerm) []queryTerm
+	String() string
+}
+
+// queryTerm: termo da consulta e o escopo de campos em que foi buscado
+// ("" = campos de texto; ver fieldScopes); word é a palavra como o usuário
+// escreveu, para mensagens ("" em termos que vieram de expansões)
+type queryTerm struct {
+	term  string
+	scope string
+	word  string
+}
+
+// scopePrefix devolve "title:" etc. para String(), ou "" sem escopo
+func scopePrefix(scope string) string {
+	if scope == "" {
+		return ""
+	}
+	return scope + ":"
+}
+
+type termNode struct {
+	term  string
+	scope string
+	word  string // palavra digitada que gerou o termo
+}
+
+func (n *termNode) eval(idx *Index) []int { return idx.postingNumsIn(n.term, n.scope) }
+func (n *termNode) positiveTerms(acc []queryTerm) []queryTerm {
+	return append(acc, queryTerm{n.term, n.scope, n.word})
+}
+func (n *termNode) String() string     { return scopePrefix(n.scope) + n.term }
+func (n *termNode) allTerms() []string { return []string{n.term} }
+func (n *termNode) spans(idx *Index, num int) map[string][]span {
+	p := idx.posting(n.term, num)
+	if p == nil {
+		return nil
+	}
+	out := make(map[string][]span, len(p.Positions))
+	for f, ps := range p.Positions {
+		if !inScope(n.scope, f) {
+			continue
+		}
+		for _, pos := range ps {
+			out[f] = append(out[f], span{pos, pos})
+		}
+	}
+	return out
+}
+
+// span: trecho [start, end] de posições casadas dentro de um campo
+type span struct{ start, end int }
+
+// positionalNode: nó que sabe em que posições casa dentro de cada campo
+// (termos, frases e NEAR), usado para compor frases e proximidade
+type positionalNode interface {
+	queryNode
+	allTerms() []string
+	spans(idx *Index, num int) map[string][]span
+}
+
+// evalPositional: candidatos são os quadrinhos com todos os termos; fica só
+// quem tem pelo menos um trecho casado
+func evalPositional(idx *Index, n positionalNode) []int {
+	var cand []int
+	for i, t := range n.allTerms() {
+		if i == 0 {
+			cand = idx.postingNums(t)
+		} else {
+			cand = intersectSorted(cand, idx.postingNums(t))
+		}
+		if len(cand) == 0 {
+			return nil
+		}
+	}
+	var out []int
+	for _, num := range cand {
+		if len(n.spans(idx, num)) > 0 {
+			out = append(out, num)
+		}
+	}
+	return out
+}
+
+// phraseNode: termos no mesmo campo, nas mesmas distâncias relativas da
+// consulta (offsets[i] = posição do termo i menos a do primeiro; stop words
+// removidas deixam lacunas)
+type phraseNode struct {
+	terms   []string
+	offsets []int
+	scope   string
+	words   []string // palavras digitadas, uma por termo
+}
+
+func (n *phraseNode) eval(idx *Index) []int { return evalPositional(idx, n) }
+func (n *phraseNode) positiveTerms(acc []queryTerm) []queryTerm {
+	for i, t := range n.terms {
+		acc = append(acc, queryTerm{t, n.scope, n.words[i]})
+	}
+	return acc
+}
+func (n *phraseNode) String() string {
+	return scopePrefix(n.scope) + `"` + strings.Join(n.terms, " ") + `"`
+}
+func (n *phraseNode) allTerms() []string { return n.terms }
+func (n *phraseNode) spans(idx *Index, num int) map[string][]span {
+	postings := make([]*Posting, len(n.terms))
+	for i, t := range n.terms {
+		if postings[i] = idx.posting(t, num); postings[i] == nil {
+			return nil
+		}
+	}
+	out := map[string][]span{}
+	for f, starts := range postings[0].Positions {
+		if !inScope(n.scope, f) {
+			continue
+		}
+	next:
+		for _, s := range starts {
+			for k := 1; k < len(postings); k++ {
+				if !containsSorted(postings[k].Positions[f], s+n.offsets[k]) {
+					continue next
+				}
+			}
+			out[f] = append(out[f], span{s, s + n.offsets[len(n.offsets)-1]})
+		}
+	}
+	return out
+}
+
+// nearNode: left e right no mesmo campo com no máximo dist posições entre eles
+type nearNode struct {
+	left, right positionalNode
+	dist        int
+}
+
+func (n *nearNode) eval(idx *Index) []int { return evalPositional(idx, n) }
+func (n *nearNode) positiveTerms(acc []queryTerm) []queryTerm {
+	return n.right.positiveTerms(n.left.positiveTerms(acc))
+}
+func (n *nearNode) String() string {
+	return fmt.Sprintf("(%s NEAR/%d %s)", n.left, n.dist, n.right)
+}
+func (n *nearNode) allTerms() []string {
+	return append(append([]string{}, n.left.allTerms()...), n.right.allTerms()...)
+}
+func (n *nearNode) spans(idx *Index, num int) map[string][]span {
+	ls := n.left.spans(idx, num)
+	if len(ls) == 0 {
+		return nil
+	}
+	rs := n.right.spans(idx, num)
+	out := map[string][]span{}
+	for f, as := range ls {
+		for _, a := range as {
+			for _, b := range rs[f] {
+				gap := 0
+				switch {
+				case a.end < b.start:
+					gap = b.start - a.end
+				case b.end < a.start:
+					gap = a.start - b.end
+				}
+				if gap <= n.dist {
+					out[f] = append(out[f], span{min(a.start, b.start), max(a.end, b.end)})
+				}
+			}
+		}
+	}
+	return out
+}
+
+func containsSorted(a []int, v int) bool {
+	i := sort.SearchInts(a, v)
+	return i < len(a) && a[i] == v
+}
+
+type andNode struct{ children []queryNode }
+
+func (n *andNode) eval(idx *Index) []int {
+	var out []int
+	for i, c := range n.children {
+		ids := c.eval(idx)
+		if i == 0 {
+			out = ids
+		} else {
+			out = intersectSorted(out, ids)
+		}
+		if len(out) == 0 {
+			break
+		}
+	}
+	return out
+}
+func (n *andNode) positiveTerms(acc []queryTerm) []queryTerm {
+	for _, c := range n.children {
+		acc = c.positiveTerms(acc)
+	}
+	return acc
+}
+func (n *andNode) String() string { return joinNodes("AND", n.children) }
+
+type orNode struct{ children []queryNode }
+
+func (n *orNode) eval(idx *Index) []int {
+	var out []int
+	for _, c := range n.children {
+		out = unionSorted(out, c.eval(idx))
+	}
+	return out
+}
+func (n *orNode) positiveTerms(acc []queryTerm) []queryTerm {
+	for _, c := range n.children {
+		acc = c.positiveTerms(acc)
+	}
+	return acc
+}
+func (n *orNode) String() string { return joinNodes("OR", n.children) }
+
+type notNode struct{ child queryNode }
+
+func (n *notNode) eval(idx *Index) []int {
+	return differenceSorted(idx.allNums(), n.child.eval(idx))
+}
+func (n *notNode) positiveTerms(acc []queryTerm) []queryTerm { return acc }
+func (n *notNode) String() string                            { return "NOT " + n.child.String() }
+
+func joinNodes(op string, nodes []queryNode) string {
+	parts := make([]string, len(nodes))
+	for i, c := range nodes {
+		parts[i] = c.String()
+	}
+	return "(" + strings.Join(parts, " "+op+" ") + ")"
+}
+
+// queryParser: descida recursiva sobre os tokens de lexQuery; palavras e
+// frases passam pelo mesmo analisador usado na indexação
+type queryParser struct {
+	toks  []qtok
+	pos   int
+	an    *Analyzer
+	scope string // prefixo de campo em vigor (title:( ... ) vale para o grupo)
+}
+
+// parseQuery monta a árvore de avaliação da consulta. Devolve nó nil (sem erro)
+// quando nenhuma palavra gera tokens indexáveis.
+func parseQuery(s string, an *Analyzer) (queryNode, error) {
+	toks, err := lexQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{toks: toks, an: an}
+	if p.peek().kind == qtEOF {
+		return nil, &queryError{Pos: 0, Msg: "consulta vazia"}
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != qtEOF {
+		return nil, &queryError{Pos: t.pos, Msg: fmt.Sprintf("token inesperado %q", t.text)}
+	}
+	return n, nil
+}
+
+func (p *queryParser) peek() qtok { return p.toks[p.pos] }
+func (p *queryParser) next() qtok {
+	t := p.toks[p.pos]
+	if t.kind != qtEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	var children []queryNode
+	for {
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if n != nil {
+			children = append(children, n)
+		}
+		if p.peek().kind != qtOr {
+			break
+		}
+		p.next()
+	}
+	return combine(children, func(c []queryNode) queryNode { return &orNode{children: c} }), nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	var children []queryNode
+	for {
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if n != nil {
+			children = append(children, n)
+		}
+		switch p.peek().kind {
+		case qtAnd:
+			p.next()
+			continue
+		case qtWord, qtPhrase, qtNot, qtLParen:
+			// AND implícito
+			continue
+		}
+		break
+	}
+	return combine(children, func(c []queryNode) queryNode { return &andNode{children: c} }), nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if p.peek().kind == qtNot {
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil || n == nil {
+			return nil, err
+		}
+		return &notNode{child: n}, nil
+	}
+	return p.parseNear()
+}
+
+func (p *queryParser) parseNear() (queryNode, error) {
+	start := p.peek()
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == qtNear {
+		op := p.next()
+		rstart := p.peek()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		l, err := nearOperand(left, start)
+		if err != nil {
+			return nil, err
+		}
+		r, err := nearOperand(right, rstart)
+		if err != nil {
+			return nil, err
+		}
+		left = &nearNode{left: l, right: r, dist: op.dist}
+	}
+	return left, nil
+}
+
+func nearOperand(n queryNode, t qtok) (positionalNode, error) {
+	if n == nil {
+		return nil, &queryError{Pos: t.pos, Msg: "operando de NEAR sem tokens válidos"}
+	}
+	pn, ok := n.(positionalNode)
+	if !ok {
+		return nil, &queryError{Pos: t.pos, Msg: "NEAR só aceita termos, frases ou outro NEAR"}
+	}
+	return pn, nil
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	t := p.next()
+	switch t.kind {
+	case qtWord:
+		if name, rest, ok := strings.Cut(t.text, ":"); ok {
+			if scope := strings.ToLower(name); fieldScopes[scope] != nil {
+				return p.parseScoped(scope, rest, t)
+			}
+		}
+		return p.wordNode(t.text), nil
+	case qtPhrase:
+		return termsNode(p.an.Analyze(t.text), p.scope, t.text), nil
+	case qtLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != qtRParen {
+			return nil, &queryError{Pos: c.pos, Msg: "esperado ')'"}
+		}
+		return n, nil
+	case qtEOF:
+		return nil, &queryError{Pos: t.pos, Msg: "fim inesperado da consulta"}
+	default:
+		return nil, &queryError{Pos: t.pos, Msg: fmt.Sprintf("token inesperado %q", t.text)}
+	}
+}
+
+// parseScoped trata campo:item. O prefixo vale para a palavra colada nele ou,
+// se vier sozinho, para a frase ou o grupo entre parênteses seguinte.
+func (p *queryParser) parseScoped(scope, rest string, t qtok) (queryNode, error) {
+	outer := p.scope
+	p.scope = scope
+	defer func() { p.scope = outer }()
+	if rest != "" {
+		return p.wordNode(rest), nil
+	}
+	switch p.peek().kind {
+	case qtPhrase, qtLParen:
+		return p.parsePrimary()
+	}
+	return nil, &queryError{Pos: t.pos, Msg: fmt.Sprintf("esperado termo, frase ou ( logo após %q", t.text)}
+}
+
+// wordNode: palavra avulsa (termo, curinga ou várias partes) no escopo atual
+func (p *queryParser) wordNode(w string) queryNode {
+	if isWildcard(w) {
+		return &wildcardNode{pattern: p.an.normalize(w), scope: p.scope}
+	}
+	return termsNode(p.an.Analyze(w), p.scope, w)
+}
+
+// termsNode: uma palavra que o tokenizador quebra em vários tokens (ou uma
+// frase) vira phraseNode; um único token vira termNode. src é o texto que
+// gerou os tokens (Start/End apontam para ele).
+func termsNode(toks []Token, scope, src string) queryNode {
+	switch len(toks) {
+	case 0:
+		return nil
+	case 1:
+		return &termNode{term: toks[0].Term, scope: scope, word: src[toks[0].Start:toks[0].End]}
+	}
+	n := &phraseNode{scope: scope}
+	for _, t := range toks {
+		n.terms = append(n.terms, t.Term)
+		n.offsets = append(n.offsets, t.Pos-toks[0].Pos)
+		n.words = append(n.words, src[t.Start:t.End])
+	}
+	return n
+}
+
+func combine(children []queryNode, mk func([]queryNode) queryNode) queryNode {
+	switch len(children) {
+	case 0:
+		return nil
+	case 1:
+		return children[0]
+	}
+	return mk(children)
+}
+
+// searchOptions ajusta a avaliação da consulta
+type searchOptions struct {
+	Fuzzy         int    // expande cada termo para os termos do índice a até Fuzzy edições
+	MaxExpansions int    // máximo de termos por curinga (0 = defaultMaxExpansions)
+	Since, Until  string // AAAA-MM-DD inclusivos ("" = sem limite); ver parseDateBound
+	Sort          string // relevance (padrão), date ou num
+	Synonyms      synonymGroups
+}
+
+// sortModes: ordenações aceitas em searchOptions.Sort
+var sortModes = []string{"relevance", "date", "num"}
+
+// searchResponse: resultados ordenados e informações para o usuário
+type searchResponse struct {
+	Results     []searchResult
+	Expanded    map[string][]string // termo/padrão da consulta -> termos usados no lugar
+	Truncated   map[string]int      // padrão cuja expansão foi cortada -> total de termos que casaram
+	Suggestions map[string][]string // termo sem ocorrência -> termos parecidos
+	Terms       []queryTerm         // termos (já expandidos) que contam no ranking
+}
+
+// search avalia a consulta sobre o índice e ordena os quadrinhos por relevância.
+// Sem resultados, sugere termos parecidos para os termos que não existem no índice.
+func (idx *Index) search(q string, opts searchOptions) (*searchResponse, error) {
+	n, err := parseQuery(q, idx.an)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
+		return nil, errNoTokens
+	}
+	resp := &searchResponse{Expanded: map[string][]string{}, Truncated: map[string]int{}, Suggestions: map[string][]string{}}
+	if len(opts.Synonyms) > 0 {
+		n = opts.Synonyms.compile(idx.an).expand(n, func(key string, forms []string) {
+			resp.Expanded[key] = forms
+		})
+	}
+	limit := opts.MaxExpansions
+	if limit <= 0 {
+		limit = defaultMaxExpansions
+	}
+	var werr error
+	walkQuery(n, func(q queryNode) {
+		w, ok := q.(*wildcardNode)
+		if !ok || werr != nil {
+			return
+		}
+		terms, shown, total, err := idx.expandWildcard(w.pattern, limit)
+		if err != nil {
+			werr = fmt.Errorf("%s: %w", w.pattern, err)
+			return
+		}
+		w.terms = terms
+		resp.Expanded[w.pattern] = shown
+		if total > len(terms) {
+			resp.Truncated[w.pattern] = total
+		}
+	})
+	if werr != nil {
+		return nil, werr
+	}
+	if opts.Fuzzy > 0 {
+		n = expandTerms(n, func(t *termNode) []string {
+			ts := idx.fuzzyTerms(t.term, opts.Fuzzy)
+			if len(ts) > 1 || ts[0] != t.term {
+				resp.Expanded[t.word] = idx.labels(ts)
+			}
+			return ts
+		})
+	}
+	nums := n.eval(idx)
+	if opts.Since != "" || opts.Until != "" {
+		nums = idx.filterDate(nums, opts.Since, opts.Until)
+	}
+	resp.Terms = n.positiveTerms(nil)
+	resp.Results = idx.rank(resp.Terms, nums)
+	idx.sortResults(resp.Results, opts.Sort)
+	if len(resp.Results) == 0 {
+		for _, qt := range n.positiveTerms(nil) {
+			if _, ok := idx.Terms[qt.term]; ok {
+				continue
+			}
+			if s := idx.suggest(qt.term, 3); len(s) > 0 {
+				resp.Suggestions[qt.word] = idx.labels(s)
+			}
+		}
+	}
+	return resp, nil
+}
+
+// walkQuery visita todos os nós da árvore (pré-ordem)
+func walkQuery(n queryNode, fn func(queryNode)) {
+	fn(n)
+	switch n := n.(type) {
+	case *andNode:
+		for _, c := range n.children {
+			walkQuery(c, fn)
+		}
+	case *orNode:
+		for _, c := range n.children {
+			walkQuery(c, fn)
+		}
+	case *notNode:
+		walkQuery(n.child, fn)
+	case *nearNode:
+		walkQuery(n.left, fn)
+		walkQuery(n.right, fn)
+	}
+}
+
+// expandTerms troca cada termo avulso (fora de frases e NEAR, que exigem
+// posições exatas) pelo OR dos termos devolvidos por expand
+func expandTerms(n queryNode, expand func(*termNode) []string) queryNode {
+	switch n := n.(type) {
+	case *termNode:
+		ts := expand(n)
+		if len(ts) == 1 {
+			return &termNode{term: ts[0], scope: n.scope, word: n.word}
+		}
+		or := &orNode{}
+		for _, t := range ts {
+			or.children = append(or.children, &termNode{term: t, scope: n.scope, word: n.word})
+		}
+		return or
+	case *andNode:
+		out := &andNode{}
+		for _, c := range n.children {
+			out.children = append(out.children, expandTerms(c, expand))
+		}
+		return out
+	case *orNode:
+		out := &orNode{}
+		for _, c := range n.children {
+			out.children = append(out.children, expandTerms(c, expand))
+		}
+		return out
+	case *notNode:
+		return &notNode{child: expandTerms(n.child, expand)}
+	}
+	return n
+}
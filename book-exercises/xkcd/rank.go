@@ -0,0 +1,144 @@
+// rank.go
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// parâmetros do BM25
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// searchResult: quadrinho encontrado, sua pontuação de relevância e os campos
+// em que algum termo da consulta aparece (na ordem de indexedFields)
+type searchResult struct {
+	Num    int
+	Score  float64
+	Fields []string
+}
+
+// avgFieldLens calcula o tamanho médio de cada campo sobre todos os documentos
+func (idx *Index) avgFieldLens() map[string]float64 {
+	sums := map[string]float64{}
+	for _, d := range idx.Docs {
+		for f, l := range d.Lens {
+			sums[f] += float64(l)
+		}
+	}
+	n := float64(len(idx.Docs))
+	for f := range sums {
+		sums[f] /= n
+	}
+	return sums
+}
+
+// idf no estilo BM25 (sempre positivo)
+func (idx *Index) idf(term string) float64 {
+	n := float64(len(idx.Docs))
+	df := float64(len(idx.Terms[term]))
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+// rank pontua os quadrinhos em nums com BM25F: a frequência de cada campo é
+// normalizada pelo tamanho do campo e ponderada por fieldWeights antes da saturação.
+// Cada termo só conta nos campos do seu escopo (title:, alt:, ...).
+// O resultado vem ordenado por pontuação decrescente (empate: número crescente).
+func (idx *Index) rank(terms []queryTerm, nums []int) []searchResult {
+	want := make(map[int]struct{}, len(nums))
+	for _, n := range nums {
+		want[n] = struct{}{}
+	}
+	avg := idx.avgFieldLens()
+	scores := make(map[int]float64, len(nums))
+	matched := make(map[int]map[string]bool, len(nums))
+
+	seen := map[queryTerm]bool{}
+	for _, qt := range terms {
+		if seen[qt] {
+			continue
+		}
+		seen[qt] = true
+		idf := idx.idf(qt.term)
+		for _, p := range idx.Terms[qt.term] {
+			if _, ok := want[p.Num]; !ok {
+				continue
+			}
+			doc := idx.Docs[p.Num]
+			tf := 0.0
+			if matched[p.Num] == nil {
+				matched[p.Num] = map[string]bool{}
+			}
+			for f := range p.Positions {
+				if !inScope(qt.scope, f) {
+					continue
+				}
+				matched[p.Num][f] = true
+				norm := 1.0
+				if avg[f] > 0 && doc != nil {
+					norm = (1 - bm25B) + bm25B*float64(doc.Lens[f])/avg[f]
+				}
+				tf += fieldWeights[f] * float64(p.freq(f)) / norm
+			}
+			scores[p.Num] += idf * tf * (bm25K1 + 1) / (bm25K1 + tf)
+		}
+	}
+
+	out := make([]searchResult, 0, len(nums))
+	for _, n := range nums {
+		r := searchResult{Num: n, Score: scores[n]}
+		for _, f := range indexedFields {
+			if matched[n][f] {
+				r.Fields = append(r.Fields, f)
+			}
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Num < out[j].Num
+	})
+	return out
+}
+
+// sortResults reordena resultados já ranqueados: date (mais antigos primeiro;
+// sem data no fim) ou num; relevance ou "" mantém a ordem de rank
+func (idx *Index) sortResults(rs []searchResult, mode string) {
+	switch mode {
+	case "date":
+		date := func(n int) string {
+			if d := idx.Docs[n]; d != nil && d.Date != "" {
+				return d.Date
+			}
+			return "9999"
+		}
+		sort.SliceStable(rs, func(i, j int) bool {
+			if a, b := date(rs[i].Num), date(rs[j].Num); a != b {
+				return a < b
+			}
+			return rs[i].Num < rs[j].Num
+		})
+	case "num":
+		sort.SliceStable(rs, func(i, j int) bool { return rs[i].Num < rs[j].Num })
+	}
+}
+
+// filterDate mantém os quadrinhos publicados entre since e until (AAAA-MM-DD,
+// inclusivos; "" = sem limite). Quadrinhos sem data ficam de fora.
+func (idx *Index) filterDate(nums []int, since, until string) []int {
+	var out []int
+	for _, n := range nums {
+		d := idx.Docs[n]
+		if d == nil || d.Date == "" {
+			continue
+		}
+		if (since == "" || d.Date >= since) && (until == "" || d.Date <= until) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
@@ -0,0 +1,147 @@
+// ratelimit.go
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter: token bucket compartilhado por todos os workers. Com rate <= 0
+// não limita, mas ainda respeita pausas pedidas via Retry-After.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens por segundo
+	burst  float64
+	tokens float64
+	last   time.Time
+	until  time.Time // ninguém passa antes disso (Retry-After)
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	b := float64(max(burst, 1))
+	return &rateLimiter{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+// wait bloqueia até haver um token (ou ctx ser cancelado). O token é reservado
+// na hora, então chamadas concorrentes saem espaçadas de 1/rate.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	var d time.Duration
+	if l.rate > 0 {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		l.tokens--
+		if l.tokens < 0 {
+			d = time.Duration(-l.tokens / l.rate * float64(time.Second))
+		}
+	}
+	l.mu.Unlock()
+	if d > 0 && !sleepCtx(ctx, d) {
+		return ctx.Err()
+	}
+	// uma pausa (Retry-After) pode ter começado enquanto esperávamos: espera o
+	// fim dela e pega um token novo, para os workers não saírem todos juntos
+	l.mu.Lock()
+	p := time.Until(l.until)
+	l.mu.Unlock()
+	if p > 0 {
+		if !sleepCtx(ctx, p) {
+			return ctx.Err()
+		}
+		return l.wait(ctx)
+	}
+	return nil
+}
+
+// pause segura todos os workers por d (servidor pediu para esperar)
+func (l *rateLimiter) pause(d time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	if t := time.Now().Add(d); t.After(l.until) {
+		l.until = t
+	}
+	l.mu.Unlock()
+}
+
+// parseRetryAfter aceita os dois formatos do cabeçalho: segundos ou data HTTP
+func parseRetryAfter(h string, now time.Time) time.Duration {
+	h = strings.TrimSpace(h)
+	if h == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(h); err == nil {
+		return time.Duration(max(s, 0)) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// retryPolicy: novas tentativas com backoff exponencial e jitter
+type retryPolicy struct {
+	Retries   int           // tentativas extras após a primeira
+	BaseDelay time.Duration // espera antes da 1ª nova tentativa (dobra a cada uma)
+	MaxDelay  time.Duration // teto do backoff
+}
+
+func defaultRetryPolicy() retryPolicy {
+	return retryPolicy{Retries: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 30 * time.Second}
+}
+
+// backoff devolve a espera antes da nova tentativa n (1, 2, ...): metade fixa
+// e metade aleatória de BaseDelay*2^(n-1), limitado a MaxDelay
+func (p retryPolicy) backoff(n int) time.Duration {
+	d := p.BaseDelay << min(n-1, 30)
+	if d > p.MaxDelay || d <= 0 {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+// do executa fn até dar certo, até um erro definitivo (404, 4xx, ctx
+// cancelado) ou até esgotar as tentativas; devolve o último erro
+func (p retryPolicy) do(ctx context.Context, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !retryable(err) || attempt >= p.Retries || ctx.Err() != nil {
+			return err
+		}
+		d := p.backoff(attempt + 1)
+		var se *statusError
+		if errors.As(err, &se) && se.RetryAfter > d {
+			d = se.RetryAfter
+		}
+		if !sleepCtx(ctx, d) {
+			return ctx.Err()
+		}
+	}
+}
+
+// retryable: erros de rede, 429 e 5xx valem nova tentativa; 404 e demais 4xx não
+func retryable(err error) bool {
+	if errors.Is(err, errComicNotFound) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.Code == http.StatusTooManyRequests || se.Code >= 500
+	}
+	return true
+}
@@ -0,0 +1,429 @@
+// serve.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// resultados por página na UI e limite padrão da API
+const pageSize = 10
+
+// server atende a API e a UI a partir do índice carregado uma vez e dos
+// JSON do cache; nada é buscado na rede
+type server struct {
+	cacheDir string
+	index    *Index
+	images   *imageManifest
+	comics   comicStore
+	synonyms synonymGroups // aplicados a toda busca, como em search e shell
+}
+
+func newServer(cacheDir string, index *Index, images *imageManifest, comics comicStore, synonyms synonymGroups) *server {
+	return &server{cacheDir: cacheDir, index: index, images: images, comics: comics, synonyms: synonyms}
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/search", s.handleAPISearch)
+	mux.HandleFunc("GET /api/comic/{num}", s.handleAPIComic)
+	mux.HandleFunc("GET /api/similar/{num}", s.handleAPISimilar)
+	mux.HandleFunc("GET /comic/{num}", s.handleComicPage)
+	mux.HandleFunc("GET /{$}", s.handleSearchPage)
+	mux.Handle("GET /images/", http.StripPrefix("/images/", http.FileServer(http.Dir(imagesDir(s.cacheDir)))))
+	return mux
+}
+
+func serveCmd(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	cacheDir := fs.String("cache", filepath.Join(os.Getenv("HOME"), defaultCacheDirName), "diretório de cache")
+	addr := fs.String("addr", "localhost:8000", "endereço para escutar")
+	synFile := fs.String("synonyms", "", "arquivo de sinônimos (padrão: "+synonymsFilename+" no cache, se existir)")
+	noSyn := fs.Bool("no-synonyms", false, "não expandir sinônimos")
+	fs.Parse(args)
+
+	var synonyms synonymGroups
+	if !*noSyn {
+		var err error
+		if synonyms, err = cacheSynonyms(*cacheDir, *synFile); err != nil {
+			fmt.Fprintf(os.Stderr, "sinônimos: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	idxPath := findIndexPath(*cacheDir)
+	index, err := loadIndex(idxPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro carregando índice (%s): %v\n", idxPath, err)
+		fmt.Fprintf(os.Stderr, "rodar `xkcd index --cache %s` primeiro\n", *cacheDir)
+		os.Exit(1)
+	}
+
+	images, err := loadImageManifest(*cacheDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warn: manifesto de imagens: %v\n", err)
+	}
+
+	comics, err := openStore(*cacheDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro abrindo o cache: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Índice carregado (%d quadrinhos). Servidor rodando em http://%s\n", len(index.Docs), *addr)
+	log.Fatal(http.ListenAndServe(*addr, newServer(*cacheDir, index, images, comics, synonyms).routes()))
+}
+
+// apiResult: um quadrinho na resposta de /api/search
+type apiResult struct {
+	Num      int     `json:"num"`
+	Title    string  `json:"title"`
+	URL      string  `json:"url"`
+	Img      string  `json:"img"`
+	LocalImg string  `json:"local_img,omitempty"` // /images/... quando baixada
+	Score    float64 `json:"score"`
+}
+
+// localImageURL: URL da imagem servida a partir do cache, ou "" se não baixada
+func (s *server) localImageURL(num int) string {
+	if rel := s.images.localImage(num); rel != "" {
+		return "/" + filepath.ToSlash(rel)
+	}
+	return ""
+}
+
+// apiSearchResponse: corpo de /api/search
+type apiSearchResponse struct {
+	Query       string              `json:"query"`
+	Total       int                 `json:"total"`
+	Offset      int                 `json:"offset"`
+	Results     []apiResult         `json:"results"`
+	Expanded    map[string][]string `json:"expanded,omitempty"`
+	Suggestions map[string][]string `json:"suggestions,omitempty"`
+}
+
+// searchPage avalia a busca e carrega do cache só os quadrinhos da página pedida
+func (s *server) searchPage(q string, opts searchOptions, offset, limit int) (*apiSearchResponse, error) {
+	opts.Synonyms = s.synonyms
+	resp, err := s.index.search(q, opts)
+	if err != nil {
+		return nil, err
+	}
+	out := &apiSearchResponse{
+		Query:       q,
+		Total:       len(resp.Results),
+		Offset:      offset,
+		Results:     []apiResult{},
+		Expanded:    resp.Expanded,
+		Suggestions: resp.Suggestions,
+	}
+	end := min(offset+limit, len(resp.Results))
+	for _, r := range resp.Results[min(offset, end):end] {
+		c, err := loadComic(s.comics, r.Num)
+		if err != nil {
+			log.Printf("erro lendo quadrinho %d: %v", r.Num, err)
+			continue
+		}
+		out.Results = append(out.Results, apiResult{
+			Num:      c.Num,
+			Title:    c.Title,
+			URL:      comicURL(c.Num),
+			Img:      c.Img,
+			LocalImg: s.localImageURL(c.Num),
+			Score:    r.Score,
+		})
+	}
+	return out, nil
+}
+
+// apiSimilar: um quadrinho na resposta de /api/similar/{num} e na página do quadrinho
+type apiSimilar struct {
+	Num    int      `json:"num"`
+	Title  string   `json:"title"`
+	URL    string   `json:"url"`
+	Score  float64  `json:"score"`
+	Shared []string `json:"shared_terms"`
+}
+
+// similarComics: os limit quadrinhos mais parecidos com num, com título do cache
+func (s *server) similarComics(num, limit int) ([]apiSimilar, error) {
+	rs, err := s.index.similar(num, limit)
+	if err != nil {
+		return nil, err
+	}
+	out := []apiSimilar{}
+	for _, r := range rs {
+		c, err := loadComic(s.comics, r.Num)
+		if err != nil {
+			log.Printf("erro lendo quadrinho %d: %v", r.Num, err)
+			continue
+		}
+		out = append(out, apiSimilar{Num: c.Num, Title: c.Title, URL: comicURL(c.Num), Score: r.Score, Shared: r.Shared})
+	}
+	return out, nil
+}
+
+// searchParams lê q, fuzzy, offset e limit da query string
+func searchParams(v url.Values) (q string, opts searchOptions, offset, limit int, err error) {
+	q = strings.TrimSpace(v.Get("q"))
+	limit = pageSize
+	for name, dst := range map[string]*int{"fuzzy": &opts.Fuzzy, "offset": &offset, "limit": &limit} {
+		if s := v.Get(name); s != "" {
+			n, convErr := strconv.Atoi(s)
+			if convErr != nil || n < 0 {
+				return "", opts, 0, 0, fmt.Errorf("parâmetro %s inválido: %q", name, s)
+			}
+			*dst = n
+		}
+	}
+	if opts.Fuzzy > maxFuzzy {
+		return "", opts, 0, 0, fmt.Errorf("fuzzy deve estar entre 0 e %d", maxFuzzy)
+	}
+	limit = min(max(limit, 1), 100)
+	return q, opts, offset, limit, nil
+}
+
+func (s *server) handleAPISearch(w http.ResponseWriter, r *http.Request) {
+	q, opts, offset, limit, err := searchParams(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if q == "" {
+		writeJSONError(w, http.StatusBadRequest, errors.New("parâmetro q obrigatório"))
+		return
+	}
+	resp, err := s.searchPage(q, opts, offset, limit)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// comicFromRequest carrega o quadrinho {num} do cache, respondendo 400/404 em caso de erro
+func (s *server) comicFromRequest(w http.ResponseWriter, r *http.Request, fail func(http.ResponseWriter, int, error)) (*XKCD, bool) {
+	num, err := strconv.Atoi(r.PathValue("num"))
+	if err != nil || num <= 0 {
+		fail(w, http.StatusBadRequest, fmt.Errorf("número inválido: %q", r.PathValue("num")))
+		return nil, false
+	}
+	c, err := loadComic(s.comics, num)
+	if errors.Is(err, os.ErrNotExist) {
+		fail(w, http.StatusNotFound, fmt.Errorf("quadrinho %d não está no cache", num))
+		return nil, false
+	}
+	if err != nil {
+		fail(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return c, true
+}
+
+func (s *server) handleAPIComic(w http.ResponseWriter, r *http.Request) {
+	if c, ok := s.comicFromRequest(w, r, writeJSONError); ok {
+		writeJSON(w, http.StatusOK, c)
+	}
+}
+
+func (s *server) handleAPISimilar(w http.ResponseWriter, r *http.Request) {
+	num, err := strconv.Atoi(r.PathValue("num"))
+	if err != nil || num <= 0 {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("número inválido: %q", r.PathValue("num")))
+		return
+	}
+	limit := defaultSimilarLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("parâmetro limit inválido: %q", v))
+			return
+		}
+		limit = min(limit, 100)
+	}
+	rs, err := s.similarComics(num, limit)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"num": num, "results": rs})
+}
+
+func (s *server) handleSearchPage(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		View        string
+		Query       string
+		Fuzzy       int
+		FuzzyLevels []int
+		Error       string
+		Resp        *apiSearchResponse
+		Prev        string
+		Next        string
+	}{View: "search"}
+	for i := 0; i <= maxFuzzy; i++ {
+		data.FuzzyLevels = append(data.FuzzyLevels, i)
+	}
+
+	q, opts, offset, limit, err := searchParams(r.URL.Query())
+	data.Query, data.Fuzzy = q, opts.Fuzzy
+	switch {
+	case err != nil:
+		data.Error = err.Error()
+	case q != "":
+		resp, err := s.searchPage(q, opts, offset, limit)
+		if err != nil {
+			data.Error = err.Error()
+			break
+		}
+		data.Resp = resp
+		page := func(off int) string {
+			v := url.Values{"q": {q}, "offset": {strconv.Itoa(off)}}
+			if opts.Fuzzy > 0 {
+				v.Set("fuzzy", strconv.Itoa(opts.Fuzzy))
+			}
+			if limit != pageSize {
+				v.Set("limit", strconv.Itoa(limit))
+			}
+			return "/?" + v.Encode()
+		}
+		if offset > 0 {
+			data.Prev = page(max(offset-limit, 0))
+		}
+		if offset+limit < resp.Total {
+			data.Next = page(offset + limit)
+		}
+	}
+	s.render(w, http.StatusOK, data)
+}
+
+func (s *server) handleComicPage(w http.ResponseWriter, r *http.Request) {
+	fail := func(w http.ResponseWriter, status int, err error) {
+		s.render(w, status, struct{ View, Error string }{"error", err.Error()})
+	}
+	c, ok := s.comicFromRequest(w, r, fail)
+	if !ok {
+		return
+	}
+	img := s.localImageURL(c.Num)
+	if img == "" {
+		img = c.Img
+	}
+	similar, err := s.similarComics(c.Num, defaultSimilarLimit)
+	if err != nil {
+		// quadrinho no cache mas ainda não indexado
+		log.Printf("parecidos com %d: %v", c.Num, err)
+	}
+	s.render(w, http.StatusOK, struct {
+		View    string
+		Comic   *XKCD
+		URL     string
+		Img     string
+		Similar []apiSimilar
+	}{"comic", c, comicURL(c.Num), img, similar})
+}
+
+func (s *server) render(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := pageTemplate.Execute(w, data); err != nil {
+		log.Printf("erro renderizando página: %v", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("erro escrevendo JSON: %v", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>xkcd search</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; background: #f5f5f5; }
+        .container { max-width: 900px; margin: 0 auto; background: white; padding: 20px; border-radius: 8px; }
+        h1 a { color: #333; text-decoration: none; }
+        form input[type=text] { width: 60%; padding: 6px; }
+        .result { border-bottom: 1px solid #ddd; padding: 10px 0; }
+        .meta { color: #666; font-size: 0.9em; }
+        .error { color: #dc3545; }
+        .nav a { margin-right: 15px; }
+        pre { white-space: pre-wrap; background: #f8f9fa; padding: 10px; }
+        img { max-width: 100%; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1><a href="/">xkcd search</a></h1>
+        {{if eq .View "search"}}
+            <form action="/" method="get">
+                <input type="text" name="q" value="{{.Query}}" placeholder='physics OR chemistry -biology "black hole"' autofocus>
+                fuzzy <select name="fuzzy">
+                    {{range .FuzzyLevels}}<option{{if eq . $.Fuzzy}} selected{{end}}>{{.}}</option>{{end}}
+                </select>
+                <input type="submit" value="Buscar">
+            </form>
+            {{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+            {{with .Resp}}
+                <p class="meta">{{.Total}} resultado(s){{range $t, $ts := .Expanded}} | {{$t}} &rarr; {{range $i, $x := $ts}}{{if $i}}, {{end}}{{$x}}{{end}}{{end}}</p>
+                {{range $t, $ss := .Suggestions}}
+                    <p>Você quis dizer ({{$t}}): {{range $i, $x := $ss}}{{if $i}}, {{end}}<a href="/?q={{$x}}">{{$x}}</a>{{end}}</p>
+                {{end}}
+                {{range .Results}}
+                <div class="result">
+                    <strong><a href="/comic/{{.Num}}">#{{.Num}} {{.Title}}</a></strong>
+                    <div class="meta">
+                        score {{printf "%.3f" .Score}} |
+                        <a href="{{.URL}}" target="_blank">xkcd.com</a> |
+                        <a href="{{if .LocalImg}}{{.LocalImg}}{{else}}{{.Img}}{{end}}" target="_blank">imagem</a>
+                    </div>
+                </div>
+                {{end}}
+            {{end}}
+            <p class="nav">
+                {{if .Prev}}<a href="{{.Prev}}">&larr; anteriores</a>{{end}}
+                {{if .Next}}<a href="{{.Next}}">próximos &rarr;</a>{{end}}
+            </p>
+        {{else if eq .View "comic"}}
+            {{with .Comic}}
+            <h2>#{{.Num}} {{.Title}}</h2>
+            <p class="meta">{{.Year}}-{{.Month}} | <a href="{{$.URL}}" target="_blank">xkcd.com</a> | <a href="/api/comic/{{.Num}}">JSON</a></p>
+            <p><a href="{{$.Img}}" target="_blank"><img src="{{$.Img}}" alt="{{.Alt}}" title="{{.Alt}}"></a></p>
+            <p><em>{{.Alt}}</em></p>
+            {{if .Transcript}}<pre>{{.Transcript}}</pre>{{end}}
+            {{end}}
+            {{with .Similar}}
+                <h3>Parecidos</h3>
+                {{range .}}
+                <div class="result">
+                    <a href="/comic/{{.Num}}">#{{.Num}} {{.Title}}</a>
+                    <span class="meta">{{printf "%.3f" .Score}}{{if .Shared}} | {{range $i, $t := .Shared}}{{if $i}}, {{end}}{{$t}}{{end}}{{end}}</span>
+                </div>
+                {{end}}
+            {{end}}
+        {{else}}
+            <p class="error">{{.Error}}</p>
+        {{end}}
+    </div>
+</body>
+</html>
+`))
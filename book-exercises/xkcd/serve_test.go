@@ -0,0 +1,169 @@
+// serve_test.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestServer monta um cache com três quadrinhos e o índice correspondente
+func newTestServer(t *testing.T) http.Handler {
+	return newTestServerSynonyms(t, nil)
+}
+
+func newTestServerSynonyms(t *testing.T, synonyms synonymGroups) http.Handler {
+	t.Helper()
+	dir := t.TempDir()
+	cs := &dirStore{dir: dir}
+	putComic(t, cs, XKCD{Num: 1, Title: "Barrel", Alt: "Don't we all.", Year: "2006", Month: "1", Day: "1", Img: "https://imgs.xkcd.com/comics/barrel.jpg"})
+	putComic(t, cs, XKCD{Num: 2, Title: "Petit Trees", Alt: "a sapling in a barrel", Year: "2006", Month: "1", Day: "1"})
+	putComic(t, cs, XKCD{Num: 1597, Title: "Git", Alt: "git commands <script>", Year: "2015", Month: "10", Day: "30"})
+	idx, _, err := buildIndexFromCache(cs, testAnalyzer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newServer(dir, idx, &imageManifest{}, cs, synonyms).routes()
+}
+
+func get(t *testing.T, h http.Handler, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestAPISearch(t *testing.T) {
+	h := newTestServer(t)
+	rec := get(t, h, "/api/search?q=git")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var resp apiSearchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 1 || len(resp.Results) != 1 || resp.Results[0].Num != 1597 {
+		t.Fatalf("resposta = %+v", resp)
+	}
+	if resp.Results[0].URL != "https://xkcd.com/1597/" {
+		t.Errorf("url = %q", resp.Results[0].URL)
+	}
+
+	for _, target := range []string{"/api/search", "/api/search?q=git&limit=x", "/api/search?q=git&fuzzy=9"} {
+		if rec := get(t, h, target); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, esperado 400", target, rec.Code)
+		}
+	}
+}
+
+func TestAPISearchPaging(t *testing.T) {
+	h := newTestServer(t)
+	var resp apiSearchResponse
+	rec := get(t, h, "/api/search?q=barrel&limit=1&offset=1")
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 2 || resp.Offset != 1 || len(resp.Results) != 1 {
+		t.Fatalf("resposta = %+v", resp)
+	}
+}
+
+func TestAPISearchSynonyms(t *testing.T) {
+	h := newTestServerSynonyms(t, synonymGroups{{"keg", "barrel"}})
+	var resp apiSearchResponse
+	rec := get(t, h, "/api/search?q=keg")
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 2 || len(resp.Expanded["keg"]) != 2 {
+		t.Fatalf("resposta = %+v", resp)
+	}
+
+	rec = get(t, h, "/?q=keg")
+	if body := rec.Body.String(); !strings.Contains(body, "Barrel") {
+		t.Fatalf("/?q=keg sem resultados:\n%s", body)
+	}
+}
+
+func TestAPIComic(t *testing.T) {
+	h := newTestServer(t)
+	rec := get(t, h, "/api/comic/1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var c XKCD
+	if err := json.Unmarshal(rec.Body.Bytes(), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Num != 1 || c.Title != "Barrel" {
+		t.Fatalf("quadrinho = %+v", c)
+	}
+
+	for target, want := range map[string]int{
+		"/api/comic/404": http.StatusNotFound,
+		"/api/comic/abc": http.StatusBadRequest,
+		"/api/comic/0":   http.StatusBadRequest,
+	} {
+		rec := get(t, h, target)
+		if rec.Code != want {
+			t.Errorf("%s: status %d, esperado %d", target, rec.Code, want)
+		}
+		var body map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["error"] == "" {
+			t.Errorf("%s: corpo sem error: %s", target, rec.Body)
+		}
+	}
+}
+
+func TestHTMLPages(t *testing.T) {
+	h := newTestServer(t)
+
+	rec := get(t, h, "/")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<form") {
+		t.Fatalf("/: status %d", rec.Code)
+	}
+
+	rec = get(t, h, "/?q=barrel")
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, "Barrel") || !strings.Contains(body, "/comic/1") {
+		t.Fatalf("/?q=barrel: status %d\n%s", rec.Code, body)
+	}
+
+	rec = get(t, h, "/comic/1597")
+	body = rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, "Git") {
+		t.Fatalf("/comic/1597: status %d\n%s", rec.Code, body)
+	}
+	if strings.Contains(body, "<script>") {
+		t.Error("alt text sem escape na página do quadrinho")
+	}
+
+	rec = get(t, h, "/comic/404")
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("/comic/404: status %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+// o servidor completo também responde via httptest.NewServer
+func TestServeHTTP(t *testing.T) {
+	ts := httptest.NewServer(newTestServer(t))
+	defer ts.Close()
+	res, err := http.Get(ts.URL + "/api/comic/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var c XKCD
+	if err := json.NewDecoder(res.Body).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || c.Title != "Petit Trees" {
+		t.Fatalf("status %d, quadrinho %+v", res.StatusCode, c)
+	}
+}
@@ -0,0 +1,366 @@
+// shell.go
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	historyFilename = "shell_history" // consultas do xkcd shell, uma por linha
+	historyMax      = 500
+)
+
+// shell: sessão interativa de busca; o índice é carregado uma vez e os
+// quadrinhos são lidos do cache só quando aparecem na página
+type shell struct {
+	cacheDir string
+	index    *Index
+	images   *imageManifest
+	comics   comicStore
+	opts     searchOptions
+	snip     snippetOptions
+	perPage  int
+	out      io.Writer
+
+	history []string
+	query   string
+	resp    *searchResponse
+	page    int
+	last    int // último quadrinho listado ou exibido, para :open sem número
+}
+
+var shellHelp = fmt.Sprintf(`Comandos:
+  CONSULTA          busca (mesma sintaxe de xkcd search)
+  (Enter), :next    próxima página        :prev  página anterior
+  :page N           vai para a página N
+  :show N           exibe o quadrinho N inteiro
+  :open [N]         imprime a URL do quadrinho N (ou do último exibido)
+  :sort MODO        relevance, date ou num
+  :fuzzy N          tolerância a erros de digitação (0-%d)
+  :history          consultas anteriores; !N repete a N-ésima
+  :help             esta ajuda
+  :quit             sair (ou Ctrl-D)
+`, maxFuzzy)
+
+func shellCmd(args []string) {
+	fs := flag.NewFlagSet("shell", flag.ExitOnError)
+	cacheDir := fs.String("cache", filepath.Join(os.Getenv("HOME"), defaultCacheDirName), "diretório de cache")
+	perPage := fs.Int("page-size", pageSize, "resultados por página")
+	fuzzy := fs.Int("fuzzy", 0, fmt.Sprintf("expandir cada termo para termos do índice a até N edições (0-%d)", maxFuzzy))
+	sortBy := fs.String("sort", "relevance", "ordem dos resultados: "+strings.Join(sortModes, ", "))
+	synFile := fs.String("synonyms", "", "arquivo de sinônimos (padrão: "+synonymsFilename+" no cache, se existir)")
+	noSyn := fs.Bool("no-synonyms", false, "não expandir sinônimos")
+	snippetLen := fs.Int("snippet-len", defaultSnippetLen, "tamanho (em caracteres) do trecho mostrado em cada resultado")
+	fs.Parse(args)
+
+	if *fuzzy < 0 || *fuzzy > maxFuzzy {
+		fmt.Fprintf(os.Stderr, "--fuzzy deve estar entre 0 e %d\n", maxFuzzy)
+		os.Exit(1)
+	}
+	if !slices.Contains(sortModes, *sortBy) {
+		fmt.Fprintf(os.Stderr, "ordenação desconhecida: %s (use %s)\n", *sortBy, strings.Join(sortModes, ", "))
+		os.Exit(1)
+	}
+
+	var synonyms synonymGroups
+	if !*noSyn {
+		var err error
+		if synonyms, err = cacheSynonyms(*cacheDir, *synFile); err != nil {
+			fmt.Fprintf(os.Stderr, "sinônimos: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	idxPath := findIndexPath(*cacheDir)
+	index, err := loadIndex(idxPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro carregando índice (%s): %v\n", idxPath, err)
+		fmt.Fprintf(os.Stderr, "rodar `xkcd index --cache %s` primeiro\n", *cacheDir)
+		os.Exit(1)
+	}
+	images, err := loadImageManifest(*cacheDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warn: manifesto de imagens: %v\n", err)
+	}
+	comics, err := openStore(*cacheDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro abrindo o cache: %v\n", err)
+		os.Exit(1)
+	}
+	defer comics.Close()
+	history, err := loadHistory(filepath.Join(*cacheDir, historyFilename))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warn: histórico: %v\n", err)
+	}
+
+	sh := &shell{
+		cacheDir: *cacheDir,
+		index:    index,
+		images:   images,
+		comics:   comics,
+		opts:     searchOptions{Fuzzy: *fuzzy, MaxExpansions: defaultMaxExpansions, Sort: *sortBy, Synonyms: synonyms},
+		snip:     snippetOptions{Len: *snippetLen, HL: plainHL},
+		perPage:  max(*perPage, 1),
+		out:      os.Stdout,
+		history:  history,
+	}
+	if isTerminal(os.Stdout) {
+		sh.snip.HL = ansiHL
+	}
+	// sem terminal na entrada (consultas via pipe), nada de prompt
+	prompt := ""
+	if isCharDevice(os.Stdin) {
+		prompt = "xkcd> "
+		fmt.Printf("Índice carregado (%d quadrinhos). :help lista os comandos.\n", len(index.Docs))
+	}
+
+	in := bufio.NewScanner(os.Stdin)
+	in.Buffer(make([]byte, 64*1024), 1<<20)
+	for {
+		fmt.Print(prompt)
+		if !in.Scan() {
+			break
+		}
+		if !sh.exec(strings.TrimSpace(in.Text())) {
+			return
+		}
+	}
+	if prompt != "" {
+		fmt.Println()
+	}
+	if err := in.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "erro lendo a entrada: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// exec interpreta uma linha; devolve false para encerrar a sessão
+func (sh *shell) exec(line string) bool {
+	if line == "" {
+		if sh.resp != nil {
+			sh.showPage(sh.page + 1)
+		}
+		return true
+	}
+	if strings.HasPrefix(line, "!") {
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 1 || n > len(sh.history) {
+			fmt.Fprintf(sh.out, "histórico sem a entrada %s (:history lista)\n", line[1:])
+			return true
+		}
+		line = sh.history[n-1]
+		fmt.Fprintln(sh.out, line)
+	}
+	if !strings.HasPrefix(line, ":") {
+		sh.search(line)
+		return true
+	}
+
+	cmd, arg, _ := strings.Cut(line[1:], " ")
+	arg = strings.TrimSpace(arg)
+	switch cmd {
+	case "q", "quit", "exit":
+		return false
+	case "h", "help":
+		fmt.Fprint(sh.out, shellHelp)
+	case "n", "next":
+		sh.showPage(sh.page + 1)
+	case "p", "prev":
+		sh.showPage(sh.page - 1)
+	case "page":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			fmt.Fprintf(sh.out, "página inválida: %q\n", arg)
+			return true
+		}
+		sh.showPage(n - 1)
+	case "show":
+		if n, ok := sh.comicArg(arg); ok {
+			sh.show(n)
+		}
+	case "open":
+		if n, ok := sh.comicArg(arg); ok {
+			fmt.Fprintln(sh.out, comicURL(n))
+			sh.last = n
+		}
+	case "sort":
+		if !slices.Contains(sortModes, arg) {
+			fmt.Fprintf(sh.out, "ordenação desconhecida: %q (use %s)\n", arg, strings.Join(sortModes, ", "))
+			return true
+		}
+		sh.opts.Sort = arg
+		sh.rerun()
+	case "fuzzy":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 || n > maxFuzzy {
+			fmt.Fprintf(sh.out, "fuzzy deve estar entre 0 e %d\n", maxFuzzy)
+			return true
+		}
+		sh.opts.Fuzzy = n
+		sh.rerun()
+	case "history":
+		for i, q := range sh.history {
+			fmt.Fprintf(sh.out, "%4d  %s\n", i+1, q)
+		}
+	default:
+		fmt.Fprintf(sh.out, "comando desconhecido: :%s (:help lista os comandos)\n", cmd)
+	}
+	return true
+}
+
+// comicArg lê o número de :show/:open; sem número, usa o último quadrinho visto
+func (sh *shell) comicArg(arg string) (int, bool) {
+	if arg == "" {
+		if sh.last == 0 {
+			fmt.Fprintln(sh.out, "informe o número do quadrinho")
+			return 0, false
+		}
+		return sh.last, true
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+	if err != nil || n <= 0 {
+		fmt.Fprintf(sh.out, "número inválido: %q\n", arg)
+		return 0, false
+	}
+	return n, true
+}
+
+func (sh *shell) search(q string) {
+	sh.remember(q)
+	sh.run(q)
+}
+
+// rerun repete a última consulta depois de mudar :sort ou :fuzzy
+func (sh *shell) rerun() {
+	if sh.query != "" {
+		sh.run(sh.query)
+	}
+}
+
+func (sh *shell) run(q string) {
+	resp, err := sh.index.search(q, sh.opts)
+	if err != nil {
+		fmt.Fprintf(sh.out, "consulta inválida: %v\n", err)
+		return
+	}
+	sh.query, sh.resp = q, resp
+	for _, t := range sortedKeys(resp.Expanded) {
+		fmt.Fprintf(sh.out, "%s -> %s\n", t, strings.Join(resp.Expanded[t], ", "))
+	}
+	if len(resp.Results) == 0 {
+		fmt.Fprintln(sh.out, "Nenhum resultado encontrado.")
+		for _, t := range sortedKeys(resp.Suggestions) {
+			fmt.Fprintf(sh.out, "Você quis dizer (%s): %s\n", t, strings.Join(resp.Suggestions[t], ", "))
+		}
+		return
+	}
+	sh.showPage(0)
+}
+
+// showPage lista a página p (a partir de 0) dos resultados atuais
+func (sh *shell) showPage(p int) {
+	if sh.resp == nil || len(sh.resp.Results) == 0 {
+		fmt.Fprintln(sh.out, "nenhuma busca com resultados ainda")
+		return
+	}
+	total := len(sh.resp.Results)
+	pages := (total + sh.perPage - 1) / sh.perPage
+	if p < 0 || p >= pages {
+		fmt.Fprintf(sh.out, "sem mais páginas (%d no total)\n", pages)
+		return
+	}
+	sh.page = p
+	fmt.Fprintf(sh.out, "%d resultados para %q, página %d/%d\n", total, sh.query, p+1, pages)
+	start := p * sh.perPage
+	for i, r := range sh.resp.Results[start:min(start+sh.perPage, total)] {
+		c, err := loadComic(sh.comics, r.Num)
+		if err != nil {
+			fmt.Fprintf(sh.out, "%3d. #%d (erro lendo do cache: %v)\n", start+i+1, r.Num, err)
+			continue
+		}
+		date := comicDate(c)
+		if date == "" {
+			date = "sem data"
+		}
+		fmt.Fprintf(sh.out, "%3d. #%d %s (%s)  %.2f\n", start+i+1, c.Num, c.Title, date, r.Score)
+		if _, s := sh.index.comicSnippet(c, sh.resp.Terms, sh.snip); s != "" {
+			fmt.Fprintf(sh.out, "     %s\n", s)
+		}
+		sh.last = c.Num
+	}
+	if p+1 < pages {
+		fmt.Fprintln(sh.out, "(Enter: próxima página, :show N para abrir um quadrinho)")
+	}
+}
+
+// show exibe o quadrinho inteiro, destacando os termos da última busca
+func (sh *shell) show(n int) {
+	c, err := loadComic(sh.comics, n)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(sh.out, "quadrinho %d não está no cache %s\n", n, sh.cacheDir)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(sh.out, "erro lendo quadrinho %d: %v\n", n, err)
+		return
+	}
+	field, body := comicBody(c)
+	if sh.resp != nil {
+		full := sh.snip
+		full.Full = true
+		field, body = sh.index.comicSnippet(c, sh.resp.Terms, full)
+	}
+	printComicResult(sh.out, c, localImagePath(sh.cacheDir, sh.images, c.Num), field, body)
+	sh.last = c.Num
+}
+
+// remember acrescenta a consulta ao histórico (sem repetir a anterior) e o grava
+func (sh *shell) remember(q string) {
+	if n := len(sh.history); n > 0 && sh.history[n-1] == q {
+		return
+	}
+	sh.history = append(sh.history, q)
+	if len(sh.history) > historyMax {
+		sh.history = sh.history[len(sh.history)-historyMax:]
+	}
+	if err := saveHistory(filepath.Join(sh.cacheDir, historyFilename), sh.history); err != nil {
+		fmt.Fprintf(os.Stderr, "warn: histórico: %v\n", err)
+	}
+}
+
+func loadHistory(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, l := range strings.Split(string(b), "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			out = append(out, l)
+		}
+	}
+	if len(out) > historyMax {
+		out = out[len(out)-historyMax:]
+	}
+	return out, nil
+}
+
+func saveHistory(path string, history []string) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(history, "\n")+"\n"), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,101 @@
+// show.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// showCmd, randomCmd e latestCmd exibem um quadrinho do cache; diferem só na
+// escolha do número
+func showCmd(args []string) {
+	comicViewCmd("show", args, func(cs comicStore, rest []string) (int, error) {
+		if len(rest) != 1 {
+			return 0, errors.New("informe exatamente um número de quadrinho")
+		}
+		n, err := strconv.Atoi(rest[0])
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("número inválido: %q", rest[0])
+		}
+		return n, nil
+	})
+}
+
+func randomCmd(args []string) {
+	comicViewCmd("random", args, func(cs comicStore, rest []string) (int, error) {
+		nums, err := storeNums(cs)
+		if err != nil {
+			return 0, err
+		}
+		return nums[rand.IntN(len(nums))], nil
+	})
+}
+
+func latestCmd(args []string) {
+	comicViewCmd("latest", args, func(cs comicStore, rest []string) (int, error) {
+		nums, err := storeNums(cs)
+		if err != nil {
+			return 0, err
+		}
+		return nums[len(nums)-1], nil
+	})
+}
+
+func comicViewCmd(name string, args []string, pick func(cs comicStore, rest []string) (int, error)) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	cacheDir := fs.String("cache", filepath.Join(os.Getenv("HOME"), defaultCacheDirName), "diretório de cache")
+	open := fs.Bool("open", false, "imprimir só a URL do quadrinho")
+	asJSON := fs.Bool("json", false, "imprimir o JSON do quadrinho (struct XKCD)")
+	fs.Parse(args)
+	// aceita as opções também depois do número (xkcd show 1597 --open)
+	rest := fs.Args()
+	if len(rest) > 1 {
+		fs.Parse(rest[1:])
+		rest = append([]string{rest[0]}, fs.Args()...)
+	}
+
+	cs, err := openStore(*cacheDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro abrindo o cache: %v\n", err)
+		os.Exit(1)
+	}
+	n, err := pick(cs, rest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
+	c, err := loadComic(cs, n)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "quadrinho %d não está no cache %s\n", n, *cacheDir)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro lendo o quadrinho %d: %v\n", n, err)
+		os.Exit(1)
+	}
+
+	switch {
+	case *open:
+		fmt.Println(comicURL(c.Num))
+	case *asJSON:
+		b, err := json.MarshalIndent(c, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "erro gerando JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(b))
+	default:
+		imgs, err := loadImageManifest(*cacheDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warn: manifesto de imagens: %v\n", err)
+		}
+		field, body := comicBody(c)
+		printComicResult(os.Stdout, c, localImagePath(*cacheDir, imgs, c.Num), field, body)
+	}
+}
@@ -0,0 +1,191 @@
+// similar.go
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSimilarLimit = 10
+	// similarSharedTerms: quantos termos em comum mostrar por resultado
+	similarSharedTerms = 5
+)
+
+// similarResult: quadrinho parecido, a similaridade de cosseno (0..1) e os
+// termos em comum que mais contribuíram para ela
+type similarResult struct {
+	Num    int      `json:"num"`
+	Score  float64  `json:"score"`
+	Shared []string `json:"shared_terms"`
+}
+
+// tfidfWeight: peso TF-IDF do termo num documento. A frequência soma as
+// ocorrências ponderadas por fieldWeights (year tem peso 0 e fica de fora);
+// idf = log(N/df), então termos presentes em todos os quadrinhos não contam.
+func tfidfWeight(p *Posting, idf float64) float64 {
+	tf := 0.0
+	for f, pos := range p.Positions {
+		tf += fieldWeights[f] * float64(len(pos))
+	}
+	if tf <= 0 {
+		return 0
+	}
+	return (1 + math.Log(tf)) * idf
+}
+
+// similar devolve os limit quadrinhos com vetor TF-IDF mais próximo (cosseno)
+// do quadrinho num, em ordem decrescente; usa só o índice. Uma passada pelas
+// postings calcula ao mesmo tempo a norma de todos os documentos e o produto
+// escalar com o quadrinho pedido.
+func (idx *Index) similar(num, limit int) ([]similarResult, error) {
+	if _, ok := idx.Docs[num]; !ok {
+		return nil, fmt.Errorf("quadrinho %d não está no índice", num)
+	}
+	n := float64(len(idx.Docs))
+	norms := make(map[int]float64, len(idx.Docs))
+	dots := map[int]float64{}
+	target := map[string]float64{} // termo -> peso no quadrinho pedido
+	for term, ps := range idx.Terms {
+		idf := math.Log(n / float64(len(ps)))
+		if idf <= 0 {
+			continue
+		}
+		wt := 0.0
+		if p := idx.posting(term, num); p != nil {
+			wt = tfidfWeight(p, idf)
+			target[term] = wt
+		}
+		for i := range ps {
+			w := tfidfWeight(&ps[i], idf)
+			norms[ps[i].Num] += w * w
+			if wt > 0 && ps[i].Num != num {
+				dots[ps[i].Num] += wt * w
+			}
+		}
+	}
+	if norms[num] == 0 {
+		return nil, nil
+	}
+
+	out := make([]similarResult, 0, len(dots))
+	for d, dot := range dots {
+		if dot > 0 {
+			out = append(out, similarResult{Num: d, Score: dot / math.Sqrt(norms[num]*norms[d])})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Num < out[j].Num
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	for i := range out {
+		out[i].Shared = idx.sharedTerms(target, out[i].Num, n)
+	}
+	return out, nil
+}
+
+// sharedTerms: termos do quadrinho pedido também presentes em num, pelo
+// produto dos pesos (maior contribuição para o cosseno primeiro), mostrados
+// como as palavras dos quadrinhos (label)
+func (idx *Index) sharedTerms(target map[string]float64, num int, n float64) []string {
+	type contrib struct {
+		term string
+		w    float64
+	}
+	var cs []contrib
+	for term, wt := range target {
+		if p := idx.posting(term, num); p != nil {
+			idf := math.Log(n / float64(len(idx.Terms[term])))
+			cs = append(cs, contrib{term, wt * tfidfWeight(p, idf)})
+		}
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].w != cs[j].w {
+			return cs[i].w > cs[j].w
+		}
+		return cs[i].term < cs[j].term
+	})
+	terms := make([]string, 0, similarSharedTerms)
+	for _, c := range cs[:min(len(cs), similarSharedTerms)] {
+		terms = append(terms, c.term)
+	}
+	return idx.labels(terms)
+}
+
+func similarCmd(args []string) {
+	fs := flag.NewFlagSet("similar", flag.ExitOnError)
+	cacheDir := fs.String("cache", filepath.Join(os.Getenv("HOME"), defaultCacheDirName), "diretório de cache")
+	limit := fs.Int("limit", defaultSimilarLimit, "quantos quadrinhos parecidos mostrar")
+	fs.Parse(args)
+	// aceita as opções também depois do número (xkcd similar 1597 --limit 5)
+	rest := fs.Args()
+	if len(rest) > 1 {
+		fs.Parse(rest[1:])
+		rest = append([]string{rest[0]}, fs.Args()...)
+	}
+	if len(rest) != 1 {
+		fmt.Fprintln(os.Stderr, "similar: informe exatamente um número de quadrinho")
+		usageAndExit()
+	}
+	num, err := strconv.Atoi(rest[0])
+	if err != nil || num <= 0 {
+		fmt.Fprintf(os.Stderr, "similar: número inválido: %q\n", rest[0])
+		os.Exit(1)
+	}
+	if *limit <= 0 {
+		fmt.Fprintln(os.Stderr, "--limit deve ser maior que zero")
+		os.Exit(1)
+	}
+
+	idxPath := findIndexPath(*cacheDir)
+	index, err := loadIndex(idxPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro carregando índice (%s): %v\n", idxPath, err)
+		fmt.Fprintf(os.Stderr, "rodar `xkcd index --cache %s` primeiro\n", *cacheDir)
+		os.Exit(1)
+	}
+	cs, err := openStore(*cacheDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "erro abrindo o cache: %v\n", err)
+		os.Exit(1)
+	}
+	defer cs.Close()
+
+	results, err := index.similar(num, *limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "similar: %v\n", err)
+		os.Exit(1)
+	}
+	title := ""
+	if c, err := loadComic(cs, num); err == nil {
+		title = " " + c.Title
+	} else if !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "erro lendo o quadrinho %d: %v\n", num, err)
+	}
+	if len(results) == 0 {
+		fmt.Printf("Nenhum quadrinho parecido com #%d%s.\n", num, title)
+		return
+	}
+	fmt.Printf("Parecidos com #%d%s:\n", num, title)
+	for i, r := range results {
+		c, err := loadComic(cs, r.Num)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "erro lendo o quadrinho %d: %v\n", r.Num, err)
+			continue
+		}
+		fmt.Printf("%3d. #%d %s  %.3f\n", i+1, c.Num, c.Title, r.Score)
+		fmt.Printf("     %s | termos em comum: %s\n", comicURL(c.Num), strings.Join(r.Shared, ", "))
+	}
+}
@@ -0,0 +1,29 @@
+// similar_test.go
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// os termos em comum aparecem como palavras dos quadrinhos, não como stems
+func TestSimilarSharedWords(t *testing.T) {
+	idx := newIndex(testAnalyzer(t))
+	idx.addComic(&XKCD{Num: 1, Title: "Purity", Alt: "physics and chemistry"})
+	idx.addComic(&XKCD{Num: 2, Title: "Physics", Alt: "chemistry is applied physics"})
+	idx.addComic(&XKCD{Num: 3, Title: "Barrel", Alt: "a boy in a barrel"})
+	idx.finish()
+
+	rs, err := idx.similar(1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 || rs[0].Num != 2 {
+		t.Fatalf("parecidos = %+v", rs)
+	}
+	got := slices.Clone(rs[0].Shared)
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"chemistry", "physics"}) {
+		t.Errorf("termos em comum = %v", rs[0].Shared)
+	}
+}
@@ -0,0 +1,187 @@
+// snippet.go
+package main
+
+import (
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultSnippetLen: tamanho padrão do trecho mostrado por search, em caracteres
+const defaultSnippetLen = 200
+
+// snippetFields: campos de onde sai o trecho, em ordem de preferência
+var snippetFields = []string{fieldTranscript, fieldAlt}
+
+// highlighter: marcas em volta de cada termo casado no trecho
+type highlighter struct{ pre, post string }
+
+var (
+	plainHL = highlighter{}
+	ansiHL  = highlighter{"\x1b[1;33m", "\x1b[0m"}
+	mdHL    = highlighter{"**", "**"}
+)
+
+// isTerminal: f é um terminal e o usuário não pediu NO_COLOR
+func isTerminal(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isCharDevice(f)
+}
+
+// isCharDevice: f é um terminal (ou outro dispositivo de caractere)
+func isCharDevice(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// snippetOptions: como o texto de cada resultado é mostrado
+type snippetOptions struct {
+	Len  int  // tamanho máximo do trecho, em caracteres
+	Full bool // texto inteiro em vez do trecho (ainda com destaque)
+	HL   highlighter
+}
+
+// comicSnippet escolhe o campo mostrado (o primeiro de snippetFields em que a
+// consulta casou; senão o primeiro não vazio) e devolve o nome dele e o trecho
+// em volta dos termos casados
+func (idx *Index) comicSnippet(c *XKCD, terms []queryTerm, opts snippetOptions) (field, text string) {
+	fields := comicFields(c)
+	first := ""
+	for _, f := range snippetFields {
+		t := strings.TrimSpace(fields[f])
+		if t == "" {
+			continue
+		}
+		if first == "" {
+			first = f
+		}
+		want := map[string]bool{}
+		for _, qt := range terms {
+			if inScope(qt.scope, f) {
+				want[qt.term] = true
+			}
+		}
+		if spans := matchSpans(idx.an, t, want); len(spans) > 0 {
+			return f, makeSnippet(t, spans, opts)
+		}
+	}
+	if first == "" {
+		return "", ""
+	}
+	return first, makeSnippet(strings.TrimSpace(fields[first]), nil, opts)
+}
+
+// comicBody: campo e texto completos mostrados por show (transcrição, senão alt)
+func comicBody(c *XKCD) (field, text string) {
+	for _, f := range snippetFields {
+		if t := strings.TrimSpace(comicFields(c)[f]); t != "" {
+			return f, t
+		}
+	}
+	return "", ""
+}
+
+// matchSpans devolve os trechos [início, fim) em bytes de text cujos tokens
+// (pelo mesmo analisador da indexação) estão em terms
+func matchSpans(an *Analyzer, text string, terms map[string]bool) [][2]int {
+	var out [][2]int
+	for _, t := range an.Analyze(text) {
+		if terms[t.Term] {
+			out = append(out, [2]int{t.Start, t.End})
+		}
+	}
+	return out
+}
+
+// makeSnippet recorta text em volta dos trechos casados e os destaca. O
+// recorte tem espaços e quebras de linha colapsados e "…" nas pontas cortadas.
+func makeSnippet(text string, spans [][2]int, opts snippetOptions) string {
+	if opts.Full || opts.Len <= 0 {
+		return highlight(text, spans, 0, len(text), opts.HL)
+	}
+	from, to := cutSnippet(text, spans, opts.Len)
+	s := strings.Join(strings.Fields(highlight(text, spans, from, to, opts.HL)), " ")
+	if from > 0 {
+		s = "…" + s
+	}
+	if to < len(text) {
+		s += "…"
+	}
+	return s
+}
+
+// highlight devolve text[from:to] com hl em volta de cada trecho inteiro ali dentro
+func highlight(text string, spans [][2]int, from, to int, hl highlighter) string {
+	var sb strings.Builder
+	last := from
+	for _, s := range spans {
+		if s[0] < last || s[1] > to {
+			continue
+		}
+		sb.WriteString(text[last:s[0]])
+		sb.WriteString(hl.pre)
+		sb.WriteString(text[s[0]:s[1]])
+		sb.WriteString(hl.post)
+		last = s[1]
+	}
+	sb.WriteString(text[last:to])
+	return sb.String()
+}
+
+// cutSnippet escolhe a janela [from, to) em bytes, de até maxLen caracteres,
+// que cobre mais trechos casados, começando um pouco antes do primeiro deles
+// e sem cortar palavras nas pontas
+func cutSnippet(text string, spans [][2]int, maxLen int) (from, to int) {
+	if utf8.RuneCountInString(text) <= maxLen {
+		return 0, len(text)
+	}
+	// anda n caracteres a partir do byte b (para frente ou para trás)
+	forward := func(b, n int) int {
+		for ; n > 0 && b < len(text); n-- {
+			_, size := utf8.DecodeRuneInString(text[b:])
+			b += size
+		}
+		return b
+	}
+	backward := func(b, n int) int {
+		for ; n > 0 && b > 0; n-- {
+			_, size := utf8.DecodeLastRuneInString(text[:b])
+			b -= size
+		}
+		return b
+	}
+
+	anchor := [2]int{0, 0}
+	best := -1
+	for i, s := range spans {
+		limit := forward(s[0], maxLen)
+		n := 0
+		for _, t := range spans[i:] {
+			if t[1] > limit {
+				break
+			}
+			n++
+		}
+		if n > best {
+			best, anchor = n, s
+		}
+	}
+	from = backward(anchor[0], maxLen/5)
+	to = forward(from, maxLen)
+	if to == len(text) {
+		from = backward(to, maxLen)
+	}
+	if from > 0 {
+		if i := strings.IndexAny(text[from:anchor[0]], " \t\n"); i >= 0 {
+			from += i + 1
+		}
+	}
+	if to < len(text) {
+		if i := strings.LastIndexAny(text[from:to], " \t\n"); i >= 0 && from+i >= anchor[1] {
+			to = from + i
+		}
+	}
+	return from, to
+}
@@ -0,0 +1,266 @@
+// stemmer.go
+package main
+
+import "strings"
+
+// porterStem implementa o algoritmo de Porter (1980) para inglês.
+// Palavras com algo além de a-z (dígitos, letras não latinas) ficam intactas.
+func porterStem(w string) string {
+	if len(w) <= 2 {
+		return w
+	}
+	for i := 0; i < len(w); i++ {
+		if w[i] < 'a' || w[i] > 'z' {
+			return w
+		}
+	}
+	p := &porter{b: []byte(w), k: len(w) - 1}
+	p.step1ab()
+	if p.k > 0 {
+		p.step1c()
+		p.step2()
+		p.step3()
+		p.step4()
+		p.step5()
+	}
+	return string(p.b[:p.k+1])
+}
+
+// porter: b[0..k] é a palavra atual; j marca o fim do radical após ends()
+type porter struct {
+	b    []byte
+	k, j int
+}
+
+// cons: b[i] é consoante (y é consoante no início ou depois de vogal)
+func (p *porter) cons(i int) bool {
+	switch p.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !p.cons(i-1)
+	}
+	return true
+}
+
+// m mede o número de sequências vogal-consoante em b[0..j]
+func (p *porter) m() int {
+	n, i := 0, 0
+	for ; i <= p.j && p.cons(i); i++ {
+	}
+	for {
+		for ; i <= p.j && !p.cons(i); i++ {
+		}
+		if i > p.j {
+			return n
+		}
+		for ; i <= p.j && p.cons(i); i++ {
+		}
+		n++
+		if i > p.j {
+			return n
+		}
+	}
+}
+
+func (p *porter) vowelInStem() bool {
+	for i := 0; i <= p.j; i++ {
+		if !p.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *porter) doublec(j int) bool {
+	return j >= 1 && p.b[j] == p.b[j-1] && p.cons(j)
+}
+
+// cvc: b[i-2..i] é consoante-vogal-consoante e a última não é w, x ou y
+func (p *porter) cvc(i int) bool {
+	if i < 2 || !p.cons(i) || p.cons(i-1) || !p.cons(i-2) {
+		return false
+	}
+	ch := p.b[i]
+	return ch != 'w' && ch != 'x' && ch != 'y'
+}
+
+func (p *porter) ends(s string) bool {
+	l := len(s)
+	if l > p.k+1 || string(p.b[p.k-l+1:p.k+1]) != s {
+		return false
+	}
+	p.j = p.k - l
+	return true
+}
+
+func (p *porter) setTo(s string) {
+	p.b = append(p.b[:p.j+1], s...)
+	p.k = p.j + len(s)
+}
+
+func (p *porter) r(s string) {
+	if p.m() > 0 {
+		p.setTo(s)
+	}
+}
+
+// step1ab: plurais e -ed/-ing
+func (p *porter) step1ab() {
+	if p.b[p.k] == 's' {
+		switch {
+		case p.ends("sses"):
+			p.k -= 2
+		case p.ends("ies"):
+			p.setTo("i")
+		case p.b[p.k-1] != 's':
+			p.k--
+		}
+	}
+	if p.ends("eed") {
+		if p.m() > 0 {
+			p.k--
+		}
+	} else if (p.ends("ed") || p.ends("ing")) && p.vowelInStem() {
+		p.k = p.j
+		switch {
+		case p.ends("at"):
+			p.setTo("ate")
+		case p.ends("bl"):
+			p.setTo("ble")
+		case p.ends("iz"):
+			p.setTo("ize")
+		case p.doublec(p.k):
+			p.k--
+			if ch := p.b[p.k]; ch == 'l' || ch == 's' || ch == 'z' {
+				p.k++
+			}
+		case p.m() == 1 && p.cvc(p.k):
+			p.setTo("e")
+		}
+	}
+}
+
+// step1c: y -> i quando há vogal no radical
+func (p *porter) step1c() {
+	if p.ends("y") && p.vowelInStem() {
+		p.b[p.k] = 'i'
+	}
+}
+
+func (p *porter) replaceFirst(rules [][2]string) {
+	for _, rule := range rules {
+		if p.ends(rule[0]) {
+			p.r(rule[1])
+			return
+		}
+	}
+}
+
+var porterStep2 = [][2]string{
+	{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"},
+	{"izer", "ize"}, {"bli", "ble"}, {"alli", "al"}, {"entli", "ent"}, {"eli", "e"},
+	{"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"}, {"ator", "ate"},
+	{"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"}, {"ousness", "ous"},
+	{"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"}, {"logi", "log"},
+}
+
+var porterStep3 = [][2]string{
+	{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+	{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+}
+
+var porterStep4 = []string{
+	"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment",
+	"ent", "ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize",
+}
+
+func (p *porter) step2() { p.replaceFirst(porterStep2) }
+func (p *porter) step3() { p.replaceFirst(porterStep3) }
+
+func (p *porter) step4() {
+	for _, s := range porterStep4 {
+		if !p.ends(s) {
+			continue
+		}
+		if s == "ion" && (p.j < 0 || (p.b[p.j] != 's' && p.b[p.j] != 't')) {
+			continue
+		}
+		if p.m() > 1 {
+			p.k = p.j
+		}
+		return
+	}
+}
+
+// step5: remove -e final e reduz -ll
+func (p *porter) step5() {
+	p.j = p.k
+	if p.b[p.k] == 'e' {
+		if a := p.m(); a > 1 || (a == 1 && !p.cvc(p.k-1)) {
+			p.k--
+		}
+	}
+	if p.b[p.k] == 'l' && p.doublec(p.k) && p.m() > 1 {
+		p.k--
+	}
+}
+
+// ptRule: troca suffix por repl se sobrarem pelo menos minStem letras
+type ptRule struct {
+	suffix, repl string
+	minStem      int
+}
+
+// Etapas do stemmer leve de português (inspirado no RSLP). Em cada etapa vale
+// a primeira regra que casar. As regras supõem texto já sem acentos.
+var portugueseSteps = [][]ptRule{
+	// plural
+	{
+		{"oes", "ao", 2}, {"aes", "ao", 2}, {"ais", "al", 2}, {"eis", "el", 2},
+		{"ois", "ol", 2}, {"ns", "m", 2}, {"res", "r", 3}, {"les", "l", 3},
+		{"zes", "z", 3}, {"s", "", 3},
+	},
+	// advérbio
+	{{"mente", "", 4}},
+	// feminino
+	{{"ona", "ao", 3}, {"ora", "or", 3}, {"eira", "eiro", 3}},
+	// aumentativo / diminutivo / superlativo
+	{
+		{"issimo", "", 3}, {"issima", "", 3}, {"zinho", "", 3}, {"zinha", "", 3},
+		{"inho", "", 3}, {"inha", "", 3},
+	},
+	// sufixos nominais
+	{
+		{"amento", "", 3}, {"imento", "", 3}, {"mento", "", 4}, {"acao", "", 3},
+		{"icao", "", 3}, {"idade", "", 3}, {"ismo", "", 3}, {"ista", "", 3},
+		{"avel", "", 3}, {"ivel", "", 3},
+	},
+	// sufixos verbais
+	{
+		{"aram", "", 3}, {"eram", "", 3}, {"iram", "", 3}, {"avam", "", 3},
+		{"ando", "", 3}, {"endo", "", 3}, {"indo", "", 3}, {"ado", "", 3},
+		{"ido", "", 3}, {"ada", "", 3}, {"ida", "", 3}, {"ava", "", 3},
+		{"ar", "", 3}, {"er", "", 3}, {"ir", "", 3},
+	},
+}
+
+// portugueseStem: stemmer leve para português
+func portugueseStem(w string) string {
+	if len(w) <= 3 {
+		return w
+	}
+	for _, step := range portugueseSteps {
+		for _, r := range step {
+			if strings.HasSuffix(w, r.suffix) && len(w)-len(r.suffix) >= r.minStem {
+				w = w[:len(w)-len(r.suffix)] + r.repl
+				break
+			}
+		}
+	}
+	// vogal temática final, só depois de consoante (preserva -ao, -eu etc.)
+	if n := len(w); n > 3 && strings.ContainsRune("aeo", rune(w[n-1])) && !strings.ContainsRune("aeiou", rune(w[n-2])) {
+		w = w[:n-1]
+	}
+	return w
+}
@@ -0,0 +1,147 @@
+// store.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// comicStore guarda os JSON dos quadrinhos baixados: um N.json por quadrinho
+// (dirStore) ou um único arquivo compactado (packStore, ver pack.go)
+type comicStore interface {
+	Has(n int) bool
+	// Get devolve o JSON do quadrinho; erro os.ErrNotExist se ausente
+	Get(n int) ([]byte, error)
+	Put(n int, b []byte) error
+	// List devolve os quadrinhos guardados, em ordem de número
+	List() ([]storedComic, error)
+	Close() error
+	String() string // onde os quadrinhos estão, para mensagens
+}
+
+// storedComic: um quadrinho no store; Size e ModTime mudam quando ele é
+// regravado e servem à atualização incremental do índice
+type storedComic struct {
+	Num     int
+	Size    int64
+	ModTime time.Time
+}
+
+// openStore abre o store do cache: o pack se ele existir, senão o diretório
+func openStore(cacheDir string) (comicStore, error) {
+	if _, err := os.Stat(filepath.Join(cacheDir, packFilename)); err == nil {
+		return openPackStore(cacheDir)
+	}
+	return &dirStore{dir: cacheDir}, nil
+}
+
+// openWritableStore: openStore para comandos que gravam no cache; no pack,
+// descarta já na abertura um registro incompleto deixado no fim
+func openWritableStore(cacheDir string) (comicStore, error) {
+	cs, err := openStore(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := cs.(*packStore); ok {
+		if err := p.dropTornTail(); err != nil {
+			p.Close()
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	return cs, nil
+}
+
+// storeNums: números dos quadrinhos no store, em ordem; erro se não houver nenhum
+func storeNums(st comicStore) ([]int, error) {
+	list, err := st.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("nenhum quadrinho em %s; rode `xkcd index` primeiro", st)
+	}
+	nums := make([]int, len(list))
+	for i, sc := range list {
+		nums[i] = sc.Num
+	}
+	return nums, nil
+}
+
+// loadComic lê e decodifica o quadrinho n do store
+func loadComic(st comicStore, n int) (*XKCD, error) {
+	b, err := st.Get(n)
+	if err != nil {
+		return nil, err
+	}
+	var c XKCD
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// dirStore: o layout original, um N.json por quadrinho no diretório do cache
+type dirStore struct {
+	dir string
+}
+
+func (d *dirStore) Has(n int) bool {
+	_, err := os.Stat(comicPath(d.dir, n))
+	return err == nil
+}
+
+func (d *dirStore) Get(n int) ([]byte, error) {
+	return os.ReadFile(comicPath(d.dir, n))
+}
+
+// Put grava num arquivo temporário e renomeia (segurança)
+func (d *dirStore) Put(n int, b []byte) error {
+	path := comicPath(d.dir, n)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// putAt é Put preservando a data de modificação (usado na migração)
+func (d *dirStore) putAt(n int, b []byte, mod time.Time) error {
+	if err := d.Put(n, b); err != nil {
+		return err
+	}
+	return os.Chtimes(comicPath(d.dir, n), mod, mod)
+}
+
+func (d *dirStore) List() ([]storedComic, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []storedComic
+	for _, e := range entries {
+		n, ok := comicNumFromName(e.Name())
+		if !ok || e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, storedComic{Num: n, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Num < out[j].Num })
+	return out, nil
+}
+
+func (d *dirStore) Close() error { return nil }
+
+func (d *dirStore) String() string { return d.dir }
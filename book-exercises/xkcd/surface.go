@@ -0,0 +1,84 @@
+// surface.go
+package main
+
+import "sort"
+
+// surfaceIndex: as palavras dos quadrinhos como aparecem no texto (minúsculas,
+// sem acentos se fold), antes do stemming. Curingas casam com elas; termos
+// mostrados ao usuário (sugestões, expansões, termos em comum) usam label.
+type surfaceIndex struct {
+	words []string          // palavras em ordem
+	terms []string          // termo do índice de cada palavra (mesma posição)
+	df    []int             // em quantos quadrinhos cada palavra aparece
+	grams map[string][]int  // trigrama -> posições (crescentes) em words
+	label map[string]string // termo -> palavra mais frequente que o gera
+}
+
+// surfaces monta o surfaceIndex a partir de DocInfo.Words (na primeira chamada)
+func (idx *Index) surfaces() *surfaceIndex {
+	idx.surfOnce.Do(func() {
+		df := map[string]int{}
+		for _, d := range idx.Docs {
+			for _, w := range d.Words {
+				df[w]++
+			}
+		}
+		s := &surfaceIndex{grams: map[string][]int{}, label: map[string]string{}}
+		best := map[string]int{}
+		for _, w := range sortedKeys(df) {
+			t := idx.an.term(w)
+			if t == "" {
+				continue
+			}
+			i := len(s.words)
+			s.words = append(s.words, w)
+			s.terms = append(s.terms, t)
+			s.df = append(s.df, df[w])
+			// palavras em ordem: no empate fica a menor
+			if df[w] > best[t] {
+				s.label[t], best[t] = w, df[w]
+			}
+			seen := map[string]bool{}
+			for _, g := range runeTrigrams(w) {
+				if !seen[g] {
+					seen[g] = true
+					s.grams[g] = append(s.grams[g], i)
+				}
+			}
+		}
+		idx.surf = s
+	})
+	return idx.surf
+}
+
+// label: a palavra que o usuário reconhece para um termo do índice (a forma
+// mais frequente nos quadrinhos), ou o próprio termo se não houver
+func (idx *Index) label(term string) string {
+	if w, ok := idx.surfaces().label[term]; ok {
+		return w
+	}
+	return term
+}
+
+// labels aplica label a cada termo, sem repetir
+func (idx *Index) labels(terms []string) []string {
+	out := make([]string, 0, len(terms))
+	seen := map[string]bool{}
+	for _, t := range terms {
+		if l := idx.label(t); !seen[l] {
+			seen[l] = true
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// prefixRange: faixa [lo, hi) de words que começa com prefix
+func (s *surfaceIndex) prefixRange(prefix string) (int, int) {
+	lo := sort.SearchStrings(s.words, prefix)
+	hi := lo + sort.Search(len(s.words)-lo, func(i int) bool {
+		w := s.words[lo+i]
+		return len(w) < len(prefix) || w[:len(prefix)] != prefix
+	})
+	return lo, hi
+}
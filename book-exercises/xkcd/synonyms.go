@@ -0,0 +1,218 @@
+// synonyms.go
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// synonymsFilename: arquivo de sinônimos lido por search no cache (ou --synonyms)
+const synonymsFilename = "synonyms.txt"
+
+// synonymGroups: cada grupo lista palavras ou frases equivalentes, como
+// escritas no arquivo (a análise depende do índice e é feita na busca)
+type synonymGroups [][]string
+
+// loadSynonyms lê o arquivo de sinônimos: um grupo por linha, termos ou
+// frases separados por vírgula; linhas vazias e começando com # são ignoradas.
+//
+//	sql, database, db
+//	ai, artificial intelligence
+func loadSynonyms(path string) (synonymGroups, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out synonymGroups
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		var g []string
+		for _, e := range strings.Split(l, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				g = append(g, e)
+			}
+		}
+		if len(g) < 2 {
+			return nil, fmt.Errorf("%s:%d: o grupo precisa de pelo menos dois termos", path, line)
+		}
+		out = append(out, g)
+	}
+	return out, sc.Err()
+}
+
+// cacheSynonyms carrega file ou, se vazio, o synonyms.txt do cache; só o
+// arquivo padrão pode faltar
+func cacheSynonyms(cacheDir, file string) (synonymGroups, error) {
+	if file != "" {
+		return loadSynonyms(file)
+	}
+	g, err := loadSynonyms(filepath.Join(cacheDir, synonymsFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return g, err
+}
+
+// synonymTable: os grupos passados pelo analisador do índice. Cada sequência
+// de termos (unida por espaço) aponta para todas as formas equivalentes,
+// inclusive ela mesma.
+type synonymTable struct {
+	alts   map[string][]synonymForm
+	text   map[string]string // sequência de termos -> forma como está no arquivo
+	maxLen int               // maior número de termos de uma forma
+}
+
+// synonymForm: uma forma do grupo, analisada, e o texto do arquivo que a gerou
+type synonymForm struct {
+	toks []Token
+	text string
+}
+
+func (g synonymGroups) compile(an *Analyzer) *synonymTable {
+	t := &synonymTable{alts: map[string][]synonymForm{}, text: map[string]string{}}
+	for _, group := range g {
+		var forms []synonymForm
+		seen := map[string]bool{}
+		for _, e := range group {
+			toks := an.Analyze(e)
+			key := tokensKey(toks)
+			// formas só com stop words não geram termos
+			if len(toks) == 0 || seen[key] {
+				continue
+			}
+			seen[key] = true
+			if _, ok := t.text[key]; !ok {
+				t.text[key] = e
+			}
+			forms = append(forms, synonymForm{toks, e})
+			t.maxLen = max(t.maxLen, len(toks))
+		}
+		if len(forms) < 2 {
+			continue
+		}
+		for _, f := range forms {
+			key := tokensKey(f.toks)
+			// um termo em dois grupos recebe as formas de ambos
+			for _, alt := range forms {
+				if !containsForm(t.alts[key], alt) {
+					t.alts[key] = append(t.alts[key], alt)
+				}
+			}
+		}
+	}
+	return t
+}
+
+func tokensKey(toks []Token) string {
+	terms := make([]string, len(toks))
+	for i, t := range toks {
+		terms[i] = t.Term
+	}
+	return strings.Join(terms, " ")
+}
+
+func containsForm(forms []synonymForm, f synonymForm) bool {
+	key := tokensKey(f.toks)
+	for _, g := range forms {
+		if tokensKey(g.toks) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// expand troca termos e frases que estão na tabela pelo OR das formas
+// equivalentes, no mesmo escopo. Termos vizinhos num AND implícito também
+// casam com frases da tabela (artificial intelligence -> ai), sem perder o
+// AND original entre as alternativas. NEAR e curingas ficam como estão. note
+// recebe cada expansão feita, com as formas escritas no arquivo.
+func (t *synonymTable) expand(n queryNode, note func(key string, forms []string)) queryNode {
+	switch n := n.(type) {
+	case *termNode:
+		return t.replace([]string{n.term}, n.scope, n, note)
+	case *phraseNode:
+		return t.replace(n.terms, n.scope, n, note)
+	case *andNode:
+		out := &andNode{}
+		for i := 0; i < len(n.children); i++ {
+			if k := t.matchRun(n.children[i:]); k > 1 {
+				run := n.children[i : i+k]
+				terms := make([]string, k)
+				for j, c := range run {
+					terms[j] = c.(*termNode).term
+				}
+				orig := &andNode{children: run}
+				n := t.replace(terms, run[0].(*termNode).scope, orig, note)
+				if or, ok := n.(*orNode); ok {
+					// as palavras em qualquer posição continuam valendo
+					or.children = append(or.children, orig)
+				}
+				out.children = append(out.children, n)
+				i += k - 1
+				continue
+			}
+			out.children = append(out.children, t.expand(n.children[i], note))
+		}
+		return out
+	case *orNode:
+		out := &orNode{}
+		for _, c := range n.children {
+			out.children = append(out.children, t.expand(c, note))
+		}
+		return out
+	case *notNode:
+		return &notNode{child: t.expand(n.child, note)}
+	}
+	return n
+}
+
+// matchRun devolve quantos termNode do início de nodes (mesmo escopo) formam
+// a maior frase da tabela, ou 0
+func (t *synonymTable) matchRun(nodes []queryNode) int {
+	var terms []string
+	scope := ""
+	for i, c := range nodes[:min(len(nodes), t.maxLen)] {
+		tn, ok := c.(*termNode)
+		if !ok || (i > 0 && tn.scope != scope) {
+			break
+		}
+		scope = tn.scope
+		terms = append(terms, tn.term)
+	}
+	for k := len(terms); k > 1; k-- {
+		if _, ok := t.alts[strings.Join(terms[:k], " ")]; ok {
+			return k
+		}
+	}
+	return 0
+}
+
+// replace monta o OR das formas equivalentes a terms, ou devolve orig
+func (t *synonymTable) replace(terms []string, scope string, orig queryNode, note func(string, []string)) queryNode {
+	key := strings.Join(terms, " ")
+	forms, ok := t.alts[key]
+	if !ok {
+		return orig
+	}
+	or := &orNode{}
+	names := make([]string, 0, len(forms))
+	for _, f := range forms {
+		or.children = append(or.children, termsNode(f.toks, scope, f.text))
+		name := t.text[tokensKey(f.toks)]
+		if len(f.toks) > 1 {
+			name = `"` + name + `"`
+		}
+		names = append(names, name)
+	}
+	note(t.text[key], names)
+	return or
+}
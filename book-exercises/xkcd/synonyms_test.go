@@ -0,0 +1,34 @@
+// synonyms_test.go
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSynonymPhraseKeepsImplicitAnd(t *testing.T) {
+	idx := newIndex(testAnalyzer(t))
+	idx.addComic(&XKCD{Num: 1, Title: "Intelligence", Alt: "nothing artificial here"})
+	idx.addComic(&XKCD{Num: 2, Title: "Artificial Intelligence"})
+	idx.addComic(&XKCD{Num: 3, Title: "AI"})
+	idx.addComic(&XKCD{Num: 4, Title: "Artificial flavour"})
+	idx.finish()
+
+	opts := searchOptions{Synonyms: synonymGroups{{"AI", "artificial intelligence"}}}
+	resp, err := idx.search("artificial intelligence", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, r := range resp.Results {
+		got = append(got, r.Num)
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, []int{1, 2, 3}) {
+		t.Fatalf("resultados = %v, esperado [1 2 3]", got)
+	}
+	want := []string{"AI", `"artificial intelligence"`}
+	if forms := resp.Expanded["artificial intelligence"]; !slices.Equal(forms, want) {
+		t.Fatalf("Expanded = %v, esperado %v", resp.Expanded, want)
+	}
+}
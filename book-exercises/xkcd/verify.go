@@ -0,0 +1,149 @@
+// verify.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// knownMissing: números que não existem no xkcd (o #404 é uma piada com o
+// próprio erro HTTP); não contam como ausentes
+var knownMissing = map[int]bool{404: true}
+
+// cacheProblem: quadrinho esperado cujo arquivo no cache está ruim
+type cacheProblem struct {
+	Num    int
+	Reason string
+}
+
+// verifyComicFile confere o quadrinho n no store; devolve "" se está tudo certo
+func verifyComicFile(cs comicStore, n int) string {
+	b, err := cs.Get(n)
+	if errors.Is(err, os.ErrNotExist) {
+		if knownMissing[n] {
+			return ""
+		}
+		return "ausente"
+	}
+	if err != nil {
+		return fmt.Sprintf("ilegível: %v", err)
+	}
+	var c XKCD
+	if err := json.Unmarshal(b, &c); err != nil {
+		return fmt.Sprintf("JSON inválido (%d bytes): %v", len(b), err)
+	}
+	if c.Num != n {
+		return fmt.Sprintf("campo num = %d, esperado %d", c.Num, n)
+	}
+	return ""
+}
+
+// verifyCache confere 1..latest e devolve os problemas em ordem de número
+func verifyCache(cs comicStore, latest int) []cacheProblem {
+	var out []cacheProblem
+	for n := 1; n <= latest; n++ {
+		if r := verifyComicFile(cs, n); r != "" {
+			out = append(out, cacheProblem{Num: n, Reason: r})
+		}
+	}
+	return out
+}
+
+func verifyCmd(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	cacheDir := fs.String("cache", filepath.Join(os.Getenv("HOME"), defaultCacheDirName), "diretório de cache")
+	latestFlag := fs.Int("latest", 0, "conferir 1..N (0 = o mais recente da origem com --repair, senão o maior número no cache)")
+	repair := fs.Bool("repair", false, "baixar de novo os quadrinhos ausentes ou corrompidos")
+	src := registerFetchFlags(fs)
+	fs.Parse(args)
+
+	ctx, stop := signalContext()
+	defer stop()
+	cs, err := openWritableStore(*cacheDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+		os.Exit(1)
+	}
+	// único ponto de fechamento: o pack grava a tabela de offsets ao fechar
+	closeStore := func() {
+		if err := cs.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "erro fechando %s: %v\n", cs, err)
+			os.Exit(1)
+		}
+	}
+
+	// um só fetcher (e limitador de taxa) para o latest e para o reparo
+	var f Fetcher
+	if *repair {
+		f = src.fetcher()
+	}
+	latest := *latestFlag
+	switch {
+	case latest > 0:
+	case *repair:
+		err := src.retry.do(ctx, func() (err error) {
+			latest, err = fetchLatestNum(ctx, f)
+			return err
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "erro obtendo latest: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		nums, err := storeNums(cs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "verify: %v\n", err)
+			os.Exit(1)
+		}
+		latest = nums[len(nums)-1]
+	}
+
+	fmt.Printf("Verificando quadrinhos 1..%d em %s...\n", latest, cs)
+	problems := verifyCache(cs, latest)
+	for _, p := range problems {
+		fmt.Printf("  #%d: %s\n", p.Num, p.Reason)
+	}
+	fmt.Printf("%d quadrinhos conferidos, %d com problema.\n", latest, len(problems))
+	if len(problems) == 0 {
+		closeStore()
+		return
+	}
+	if !*repair {
+		closeStore()
+		fmt.Fprintln(os.Stderr, "Rode `xkcd verify --repair` para baixá-los de novo.")
+		os.Exit(1)
+	}
+
+	fmt.Println("Reparando...")
+	remaining := 0
+	for _, p := range problems {
+		// downloadComic substitui o registro ruim (no pack, anexa um novo)
+		err := downloadComic(ctx, f, p.Num, cs, src.retry)
+		if ctx.Err() != nil {
+			closeStore()
+			interrupted()
+		}
+		switch r := verifyComicFile(cs, p.Num); {
+		case err != nil:
+			fmt.Printf("  #%d: falhou: %v\n", p.Num, err)
+			remaining++
+		case r == "ausente":
+			// a origem respondeu 404; downloadComic já avisou
+			remaining++
+		case r != "":
+			fmt.Printf("  #%d: ainda com problema: %s\n", p.Num, r)
+			remaining++
+		default:
+			fmt.Printf("  #%d: ok\n", p.Num)
+		}
+	}
+	fmt.Printf("Reparados: %d, restantes: %d. Rode `xkcd index` para atualizar o índice.\n", len(problems)-remaining, remaining)
+	closeStore()
+	if remaining > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,154 @@
+// wildcard.go
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultMaxExpansions: quantos termos um curinga pode gerar por padrão
+const defaultMaxExpansions = 50
+
+// minWildcardLiteral: letras fixas mínimas num padrão (evita "*" casar o vocabulário inteiro)
+const minWildcardLiteral = 2
+
+var errWildcardTooBroad = errors.New("padrão curinga muito amplo (use pelo menos 2 letras fixas)")
+
+func isWildcard(w string) bool { return strings.ContainsAny(w, "*?") }
+
+// wildcardNode: padrão com * (qualquer sequência) e ? (uma letra), comparado
+// com as palavras dos quadrinhos (ver expandWildcard). terms é preenchido por
+// search com os termos do índice dessas palavras.
+type wildcardNode struct {
+	pattern string
+	scope   string
+	terms   []string
+}
+
+func (n *wildcardNode) eval(idx *Index) []int {
+	var out []int
+	for _, t := range n.terms {
+		out = unionSorted(out, idx.postingNumsIn(t, n.scope))
+	}
+	return out
+}
+func (n *wildcardNode) positiveTerms(acc []queryTerm) []queryTerm {
+	for _, t := range n.terms {
+		acc = append(acc, queryTerm{term: t, scope: n.scope})
+	}
+	return acc
+}
+func (n *wildcardNode) String() string { return scopePrefix(n.scope) + n.pattern }
+
+func runeTrigrams(s string) []string {
+	rs := []rune(s)
+	var out []string
+	for i := 0; i+3 <= len(rs); i++ {
+		out = append(out, string(rs[i:i+3]))
+	}
+	return out
+}
+
+// expandWildcard compara o padrão com as palavras dos quadrinhos (antes do
+// stemming: physics* casa com "physics", cujo termo é "physic") e devolve os
+// termos do índice dessas palavras, no máximo limit (os mais frequentes), a
+// palavra mais comum de cada um, para exibição, e o total de termos que casaram.
+func (idx *Index) expandWildcard(pattern string, limit int) (terms, shown []string, total int, err error) {
+	literal := 0
+	for _, r := range pattern {
+		if r != '*' && r != '?' {
+			literal++
+		}
+	}
+	if literal < minWildcardLiteral {
+		return nil, nil, 0, errWildcardTooBroad
+	}
+	s := idx.surfaces()
+
+	// prefixo fixo antes do primeiro curinga: faixa contígua das palavras
+	prefix := pattern[:strings.IndexAny(pattern, "*?")]
+	lo, hi := s.prefixRange(prefix)
+
+	// trechos fixos com 3+ letras restringem os candidatos pelos trigramas
+	var cand []int
+	filtered := false
+	for _, seg := range strings.FieldsFunc(pattern[len(prefix):], func(r rune) bool { return r == '*' || r == '?' }) {
+		for _, g := range runeTrigrams(seg) {
+			if !filtered {
+				cand, filtered = s.grams[g], true
+			} else {
+				cand = intersectSorted(cand, s.grams[g])
+			}
+		}
+	}
+
+	// várias palavras podem dar o mesmo termo (physics, physical): conta uma
+	// vez, mostrada pela palavra que casou em mais quadrinhos
+	show := map[string]string{}
+	best := map[string]int{}
+	check := func(i int) {
+		if i >= lo && i < hi && matchWildcard(pattern, s.words[i]) {
+			t := s.terms[i]
+			if _, ok := idx.Terms[t]; ok && s.df[i] > best[t] {
+				show[t], best[t] = s.words[i], s.df[i]
+			}
+		}
+	}
+	if filtered {
+		for _, i := range cand {
+			check(i)
+		}
+	} else {
+		for i := lo; i < hi; i++ {
+			check(i)
+		}
+	}
+
+	terms = sortedKeys(show)
+	total = len(terms)
+	if limit > 0 && total > limit {
+		sort.SliceStable(terms, func(i, j int) bool { return len(idx.Terms[terms[i]]) > len(idx.Terms[terms[j]]) })
+		terms = terms[:limit]
+	}
+	sort.Slice(terms, func(i, j int) bool { return show[terms[i]] < show[terms[j]] })
+	for _, t := range terms {
+		shown = append(shown, show[t])
+	}
+	return terms, shown, total, nil
+}
+
+// matchWildcard compara s com o padrão (* = qualquer sequência, ? = uma rune)
+func matchWildcard(pattern, s string) bool {
+	// backtracking guardando só a última estrela
+	p, i := 0, 0
+	starP, starI := -1, 0
+	for i < len(s) {
+		if p < len(pattern) {
+			pr, psize := utf8.DecodeRuneInString(pattern[p:])
+			sr, ssize := utf8.DecodeRuneInString(s[i:])
+			switch {
+			case pr == '*':
+				starP, starI = p, i
+				p += psize
+				continue
+			case pr == '?' || pr == sr:
+				p += psize
+				i += ssize
+				continue
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		// a estrela absorve mais uma rune
+		_, ssize := utf8.DecodeRuneInString(s[starI:])
+		starI += ssize
+		p, i = starP+1, starI
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
@@ -0,0 +1,51 @@
+// wildcard_test.go
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// curingas casam com as palavras como estão no texto, não com os termos
+// (physics -> physic, chemistry -> chemistri, simple -> simpl)
+func TestWildcardMatchesSurfaceWords(t *testing.T) {
+	idx := newIndex(testAnalyzer(t))
+	idx.addComic(&XKCD{Num: 1, Title: "Purity", Alt: "physics is just applied math; chemistry is applied physics"})
+	idx.addComic(&XKCD{Num: 2, Title: "Simple Answers", Alt: "the simplest answer"})
+	idx.addComic(&XKCD{Num: 3, Title: "Chemical", Alt: "chemical bonds"})
+	idx.finish()
+
+	for _, c := range []struct {
+		q     string
+		nums  []int
+		shown []string
+	}{
+		{"physics*", []int{1}, []string{"physics"}},
+		{"phys*", []int{1}, []string{"physics"}},
+		{"chemistry*", []int{1}, []string{"chemistry"}},
+		{"chem*", []int{1, 3}, []string{"chemical", "chemistry"}},
+		{"simple*", []int{2}, []string{"simple", "simplest"}},
+		{"title:simp*", []int{2}, []string{"simple", "simplest"}},
+	} {
+		resp, err := idx.search(c.q, searchOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", c.q, err)
+		}
+		var got []int
+		for _, r := range resp.Results {
+			got = append(got, r.Num)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, c.nums) {
+			t.Errorf("%s: resultados %v, esperado %v", c.q, got, c.nums)
+		}
+		pattern := c.q
+		if _, p, ok := strings.Cut(pattern, ":"); ok {
+			pattern = p
+		}
+		if shown := resp.Expanded[pattern]; !slices.Equal(shown, c.shown) {
+			t.Errorf("%s: expandido para %v, esperado %v", c.q, shown, c.shown)
+		}
+	}
+}